@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/hnakamur/webapputil"
 	"github.com/hnakamur/webapputil/problem"
 	"github.com/masa23/goloba/api"
+	"github.com/mqliang/libipvs"
 )
 
 type apiServer struct {
@@ -27,6 +29,12 @@ func (l *LoadBalancer) runAPIServer(ctx context.Context, listeners []net.Listene
 	mux := http.NewServeMux()
 	mux.Handle("/weight", wrapWithErrHandler(l.handleWeight))
 	mux.HandleFunc("/info", l.handleInfo)
+	mux.Handle("/config/reload", wrapWithErrHandler(l.handleConfigReload))
+	mux.Handle("/drain", wrapWithErrHandler(l.handleDrain))
+	mux.Handle("/metrics", wrapWithErrHandler(l.handleMetrics))
+	mux.Handle("/ha", wrapWithErrHandler(l.handleHA))
+	mux.Handle("/ha/failover", wrapWithErrHandler(l.handleHAFailover))
+	mux.Handle("/ha/maintenance", wrapWithErrHandler(l.handleHAMaintenance))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		fmt.Fprintf(w, "Hello from goloba API server\n")
@@ -95,7 +103,7 @@ func (l *LoadBalancer) handleWeight(w http.ResponseWriter, r *http.Request) *web
 	if hErr != nil {
 		return hErr
 	}
-	serviceIP, servicePort, hErr := getAddressParam(r, "service")
+	svcKey, hErr := getServiceParam(r, "service")
 	if hErr != nil {
 		return hErr
 	}
@@ -111,7 +119,7 @@ func (l *LoadBalancer) handleWeight(w http.ResponseWriter, r *http.Request) *web
 	if hErr != nil {
 		return hErr
 	}
-	err := l.changeWeight(context.TODO(), serviceIP, servicePort, destIP, destPort, uint16(weight), lock)
+	err := l.changeWeight(context.TODO(), svcKey, destIP, destPort, uint16(weight), lock)
 	if err != nil {
 		return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
 			Type:  "https://goloba.github.io/problems/internal-server-error",
@@ -126,7 +134,7 @@ func (l *LoadBalancer) handleWeight(w http.ResponseWriter, r *http.Request) *web
 		Locked      bool   `json:"locked"`
 	}{
 		Message:     "attached destination",
-		Service:     fmt.Sprintf("%s:%d", serviceIP, servicePort),
+		Service:     svcKey,
 		Destination: fmt.Sprintf("%s:%d", destIP, destPort),
 		Weight:      weight,
 		Locked:      lock,
@@ -134,6 +142,356 @@ func (l *LoadBalancer) handleWeight(w http.ResponseWriter, r *http.Request) *web
 	return nil
 }
 
+func (l *LoadBalancer) handleDrain(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodPost)
+	if hErr != nil {
+		return hErr
+	}
+	hErr = parseForm(r)
+	if hErr != nil {
+		return hErr
+	}
+	svcKey, hErr := getServiceParam(r, "service")
+	if hErr != nil {
+		return hErr
+	}
+	destIP, destPort, hErr := getAddressParam(r, "dest")
+	if hErr != nil {
+		return hErr
+	}
+	wait, hErr := getBoolParam(r, "wait", false)
+	if hErr != nil {
+		return hErr
+	}
+	timeout, hErr := getDurationParam(r, "timeout", time.Minute)
+	if hErr != nil {
+		return hErr
+	}
+	remove, hErr := getBoolParam(r, "remove", false)
+	if hErr != nil {
+		return hErr
+	}
+
+	destKey := destinationKey(svcKey, destIP, destPort)
+	err := l.drainDestination(r.Context(), destKey)
+	if err != nil {
+		return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+			Type:  "https://goloba.github.io/problems/internal-server-error",
+			Title: "failed to drain destination",
+		})
+	}
+	var active, inactive uint32
+	if wait {
+		active, inactive, err = l.waitDrained(r.Context(), destKey, timeout)
+	} else {
+		active, inactive, err = l.destinationConns(destKey)
+	}
+	if err != nil {
+		return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+			Type:  "https://goloba.github.io/problems/internal-server-error",
+			Title: "failed to get connections of draining destination",
+		})
+	}
+	drained := active == 0
+	removed := false
+	if drained && remove {
+		err = l.removeDestination(context.TODO(), destKey)
+		if err != nil {
+			return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+				Type:  "https://goloba.github.io/problems/internal-server-error",
+				Title: "failed to remove drained destination",
+			})
+		}
+		removed = true
+	}
+
+	message := "draining destination"
+	if drained {
+		message = "drained destination"
+	}
+	sendOKResponse(w, r, struct {
+		Message      string `json:"message"`
+		Service      string `json:"service"`
+		Destination  string `json:"destination"`
+		Drained      bool   `json:"drained"`
+		Removed      bool   `json:"removed"`
+		ActiveConn   uint32 `json:"active_conn"`
+		InactiveConn uint32 `json:"inactive_conn"`
+	}{
+		Message:      message,
+		Service:      svcKey,
+		Destination:  net.JoinHostPort(destIP.String(), strconv.Itoa(int(destPort))),
+		Drained:      drained,
+		Removed:      removed,
+		ActiveConn:   active,
+		InactiveConn: inactive,
+	})
+	return nil
+}
+
+func (l *LoadBalancer) handleMetrics(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodGet)
+	if hErr != nil {
+		return hErr
+	}
+	metrics, err := l.buildMetrics()
+	if err != nil {
+		return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+			Type:  "https://goloba.github.io/problems/internal-server-error",
+			Title: "failed to build metrics",
+		})
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	err = metrics.writeTo(w)
+	if err != nil {
+		ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to write metrics; %v", err)
+		}).String("requestID", webapputil.RequestID(r)).Stack(""))
+	}
+	return nil
+}
+
+func (l *LoadBalancer) handleHA(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodGet)
+	if hErr != nil {
+		return hErr
+	}
+	ha := api.HA{
+		Enabled: len(l.vrrpNodes) > 0,
+		Nodes:   make([]api.HANode, len(l.vrrpNodes)),
+	}
+	for i, n := range l.vrrpNodes {
+		node, err := n.info()
+		if err != nil {
+			return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+				Type:  "https://goloba.github.io/problems/internal-server-error",
+				Title: "failed to get HA status",
+			})
+		}
+		ha.Nodes[i] = *node
+	}
+	sendOKResponse(w, r, ha)
+	return nil
+}
+
+func (l *LoadBalancer) handleHAFailover(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodPost)
+	if hErr != nil {
+		return hErr
+	}
+	hErr = parseForm(r)
+	if hErr != nil {
+		return hErr
+	}
+	instances, hErr := l.controlHA(r, haControlFailover)
+	if hErr != nil {
+		return hErr
+	}
+	sendOKResponse(w, r, struct {
+		Message   string                `json:"message"`
+		Instances []haControlResultInfo `json:"instances"`
+	}{
+		Message:   "requested failover",
+		Instances: instances,
+	})
+	return nil
+}
+
+func (l *LoadBalancer) handleHAMaintenance(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodPost)
+	if hErr != nil {
+		return hErr
+	}
+	hErr = parseForm(r)
+	if hErr != nil {
+		return hErr
+	}
+	enable, hErr := getBoolParam(r, "enable", true)
+	if hErr != nil {
+		return hErr
+	}
+	op := haControlMaintenanceOff
+	message := "disabled maintenance mode"
+	if enable {
+		op = haControlMaintenanceOn
+		message = "enabled maintenance mode"
+	}
+	instances, hErr := l.controlHA(r, op)
+	if hErr != nil {
+		return hErr
+	}
+	sendOKResponse(w, r, struct {
+		Message     string                `json:"message"`
+		Maintenance bool                  `json:"maintenance"`
+		Instances   []haControlResultInfo `json:"instances"`
+	}{
+		Message:     message,
+		Maintenance: enable,
+		Instances:   instances,
+	})
+	return nil
+}
+
+// haControlTimeout is the timeout for the VRRP node to accept a control request.
+const haControlTimeout = 5 * time.Second
+
+type haControlResultInfo struct {
+	Name  string `json:"name,omitempty"`
+	VRID  uint8  `json:"vrid"`
+	State string `json:"state"`
+}
+
+// controlHA does op for the VRRP instance specified with the vrid parameter,
+// or all the instances if it is not specified.
+func (l *LoadBalancer) controlHA(r *http.Request, op haControlOp) ([]haControlResultInfo, *webapputil.HTTPError) {
+	if len(l.vrrpNodes) == 0 {
+		err := ltsvlog.Err(errors.New("VRRP is disabled")).Stack("")
+		return nil, webapputil.NewHTTPError(err, http.StatusConflict, problem.Problem{
+			Type:  "https://goloba.github.io/problems/vrrp-disabled",
+			Title: "VRRP is disabled",
+		})
+	}
+	vrid, hErr := getVRIDParam(r, "vrid")
+	if hErr != nil {
+		return nil, hErr
+	}
+	var nodes []*haNode
+	for _, n := range l.vrrpNodes {
+		if vrid == 0 || n.VRID == vrid {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == 0 {
+		err := ltsvlog.Err(errors.New("VRRP instance not found")).Uint8("vrid", vrid).Stack("")
+		return nil, webapputil.NewHTTPError(err, http.StatusNotFound, problem.Problem{
+			Type:  "https://goloba.github.io/problems/vrrp-instance-not-found",
+			Title: "VRRP instance not found",
+		})
+	}
+
+	if op == haControlFailover {
+		// The node would take the master back by preemption at once.
+		for _, n := range nodes {
+			if n.Preempt {
+				err := ltsvlog.Err(errors.New("failover is not allowed with preempt enabled")).Uint8("vrid", n.VRID).Stack("")
+				return nil, webapputil.NewHTTPError(err, http.StatusConflict, problem.Problem{
+					Type:  "https://goloba.github.io/problems/vrrp-preempt-enabled",
+					Title: "failover is not allowed with preempt enabled, use maintenance mode instead",
+				})
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), haControlTimeout)
+	defer cancel()
+	results := make([]haControlResultInfo, len(nodes))
+	for i, n := range nodes {
+		state, err := n.control(ctx, op, 0)
+		if err != nil {
+			return nil, webapputil.NewHTTPError(ltsvlog.WrapErr(err, nil).Uint8("vrid", n.VRID), http.StatusInternalServerError, problem.Problem{
+				Type:  "https://goloba.github.io/problems/internal-server-error",
+				Title: "failed to change HA state",
+			})
+		}
+		results[i] = haControlResultInfo{Name: n.Name, VRID: n.VRID, State: state.String()}
+	}
+	return results, nil
+}
+
+// info returns the VRRP status of the node for the API.
+func (n *haNode) info() (*api.HANode, error) {
+	held, err := n.engine.heldVIPs()
+	if err != nil {
+		return nil, err
+	}
+	status := n.status()
+	now := time.Now()
+	node := &api.HANode{
+		Name:               n.Name,
+		State:              status.State.String(),
+		VRID:               n.VRID,
+		Priority:           status.Priority,
+		BasePriority:       n.Priority,
+		Preempt:            n.Preempt,
+		LocalAddress:       n.LocalAddr.String(),
+		PeerAddress:        n.peerString(),
+		Since:              status.Since,
+		TimeInState:        now.Sub(status.Since).Seconds(),
+		Transitions:        status.Transitions,
+		Sent:               status.Sent,
+		Received:           status.Received,
+		Rejected:           status.Rejected,
+		MasterDownInterval: status.MasterDownInterval.Seconds(),
+		Maintenance:        status.Maintenance,
+		VIPInterface:       n.engine.config.vipInterface.Name,
+		VIPs:               make([]string, len(n.engine.config.vips)),
+		HeldVIPs:           make([]string, len(held)),
+	}
+	if !status.LastAdvert.IsZero() {
+		node.LastAdvert = &status.LastAdvert
+		node.LastAdvertPriority = status.LastAdvertPriority
+	}
+	for _, peer := range status.Peers {
+		p := api.HAPeer{Address: peer.Addr.String()}
+		if !peer.LastAdvert.IsZero() {
+			lastAdvert := peer.LastAdvert
+			p.LastAdvert = &lastAdvert
+			p.LastAdvertPriority = peer.LastAdvertPriority
+		}
+		node.Peers = append(node.Peers, p)
+	}
+	for i, vipCfg := range n.engine.config.vips {
+		node.VIPs[i] = vipString(vipCfg)
+	}
+	for i, vipCfg := range held {
+		node.HeldVIPs[i] = vipString(vipCfg)
+	}
+	return node, nil
+}
+
+func vipString(vipCfg *haEngineVIPConfig) string {
+	ones, _ := vipCfg.ipNet.Mask.Size()
+	return fmt.Sprintf("%s/%d", vipCfg.ip, ones)
+}
+
+func (l *LoadBalancer) handleConfigReload(w http.ResponseWriter, r *http.Request) *webapputil.HTTPError {
+	hErr := checkMethod(w, r, http.MethodPost)
+	if hErr != nil {
+		return hErr
+	}
+	ignored, err := l.ReloadConfig(r.Context())
+	if err != nil {
+		return webapputil.NewHTTPError(err, http.StatusInternalServerError, problem.Problem{
+			Type:  "https://goloba.github.io/problems/internal-server-error",
+			Title: "failed to reload config",
+		})
+	}
+	message := "reloaded config"
+	if len(ignored) > 0 {
+		message = fmt.Sprintf("reloaded config, but ignored changes of %s; restart goloba to apply them", strings.Join(ignored, ", "))
+	}
+	sendOKResponse(w, r, struct {
+		Message        string   `json:"message"`
+		IgnoredChanges []string `json:"ignored_changes,omitempty"`
+	}{
+		Message:        message,
+		IgnoredChanges: ignored,
+	})
+	return nil
+}
+
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) *webapputil.HTTPError {
+	if r.Method == method {
+		return nil
+	}
+	w.Header().Set("Allow", method)
+	err := ltsvlog.Err(errors.New("method not allowed")).String("method", r.Method).Stack("")
+	return webapputil.NewHTTPError(err, http.StatusMethodNotAllowed, problem.Problem{
+		Type:  "https://goloba.github.io/problems/method-not-allowed",
+		Title: fmt.Sprintf("method must be %s", method),
+	})
+}
+
 func parseForm(r *http.Request) *webapputil.HTTPError {
 	err := r.ParseForm()
 	if err != nil {
@@ -180,8 +538,96 @@ func getBoolParam(r *http.Request, name string, defaultValue bool) (bool, *webap
 	return value, nil
 }
 
-func getAddressParam(r *http.Request, name string) (net.IP, uint16, *webapputil.HTTPError) {
+// getServiceParam parses a service address in [<protocol>/]<IPAddr>:<port> form
+// or a firewall mark service in [<addressFamily>/]fwmark:<mark> form, and returns
+// the service key. The protocol defaults to tcp and the address family defaults to inet.
+func getServiceParam(r *http.Request, name string) (string, *webapputil.HTTPError) {
 	strVal := r.Form.Get(name)
+	var protoStr string
+	addrStr := strVal
+	if i := strings.IndexByte(strVal, '/'); i != -1 {
+		protoStr = strVal[:i]
+		addrStr = strVal[i+1:]
+	}
+	if strings.HasPrefix(addrStr, "fwmark:") {
+		return parseFWMarkServiceParam(name, strVal, protoStr, strings.TrimPrefix(addrStr, "fwmark:"))
+	}
+	proto, err := parseProtocol(protoStr)
+	if err != nil {
+		err = ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("service must be in [<protocol>/]<IPAddr>:<port> form; %v", err)
+		}).String("name", name).String("value", strVal).Stack("")
+		return "", webapputil.NewHTTPError(err, http.StatusBadRequest,
+			struct {
+				problem.Problem
+				InvalidParams []invalidParam `json:"invalid-params"`
+			}{
+				Problem: problem.Problem{
+					Type:  "https://goloba.github.io/problems/bad-request",
+					Title: "protocol must be tcp, udp or sctp",
+				},
+				InvalidParams: []invalidParam{
+					{Name: name, Value: strVal},
+				},
+			})
+	}
+	ip, port, hErr := parseAddressParam(name, addrStr)
+	if hErr != nil {
+		return "", hErr
+	}
+	return serviceKey(proto, ip, port), nil
+}
+
+func parseFWMarkServiceParam(name, strVal, afStr, markStr string) (string, *webapputil.HTTPError) {
+	af, err := parseAddressFamily(afStr)
+	if err != nil {
+		err = ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("service must be in [<addressFamily>/]fwmark:<mark> form; %v", err)
+		}).String("name", name).String("value", strVal).Stack("")
+		return "", webapputil.NewHTTPError(err, http.StatusBadRequest,
+			struct {
+				problem.Problem
+				InvalidParams []invalidParam `json:"invalid-params"`
+			}{
+				Problem: problem.Problem{
+					Type:  "https://goloba.github.io/problems/bad-request",
+					Title: "address family must be inet or inet6",
+				},
+				InvalidParams: []invalidParam{
+					{Name: name, Value: strVal},
+				},
+			})
+	}
+	mark, err := strconv.ParseUint(markStr, 10, 32)
+	if err != nil || mark == 0 {
+		if err == nil {
+			err = errors.New("firewall mark must not be zero")
+		}
+		err = ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("service must be in [<addressFamily>/]fwmark:<mark> form; %v", err)
+		}).String("name", name).String("value", strVal).Stack("")
+		return "", webapputil.NewHTTPError(err, http.StatusBadRequest,
+			struct {
+				problem.Problem
+				InvalidParams []invalidParam `json:"invalid-params"`
+			}{
+				Problem: problem.Problem{
+					Type:  "https://goloba.github.io/problems/bad-request",
+					Title: "firewall mark must be integer between 1 and 4294967295",
+				},
+				InvalidParams: []invalidParam{
+					{Name: name, Value: strVal},
+				},
+			})
+	}
+	return fwmarkServiceKey(af, uint32(mark)), nil
+}
+
+func getAddressParam(r *http.Request, name string) (net.IP, uint16, *webapputil.HTTPError) {
+	return parseAddressParam(name, r.Form.Get(name))
+}
+
+func parseAddressParam(name, strVal string) (net.IP, uint16, *webapputil.HTTPError) {
 	host, portStr, err := net.SplitHostPort(strVal)
 	if err != nil {
 		err = ltsvlog.WrapErr(err, func(err error) error {
@@ -257,6 +703,36 @@ func getAddressParam(r *http.Request, name string) (net.IP, uint16, *webapputil.
 	return ip, uint16(port), nil
 }
 
+func getDurationParam(r *http.Request, name string, defaultValue time.Duration) (time.Duration, *webapputil.HTTPError) {
+	strVal := r.Form.Get(name)
+	if strVal == "" {
+		return defaultValue, nil
+	}
+	value, err := time.ParseDuration(strVal)
+	if err != nil || value < 0 {
+		if err == nil {
+			err = errors.New("negative duration")
+		}
+		err = ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to parse duration value; %v", err)
+		}).String("name", name).String("value", strVal).Stack("")
+		return 0, webapputil.NewHTTPError(err, http.StatusBadRequest,
+			struct {
+				problem.Problem
+				InvalidParams []invalidParam `json:"invalid-params"`
+			}{
+				Problem: problem.Problem{
+					Type:  "https://goloba.github.io/problems/bad-request",
+					Title: "failed to parse duration parameter",
+				},
+				InvalidParams: []invalidParam{
+					{Name: name, Value: strVal},
+				},
+			})
+	}
+	return value, nil
+}
+
 func getWeightParam(r *http.Request, name string) (uint16, *webapputil.HTTPError) {
 	strVal := r.Form.Get(name)
 	val, err := strconv.ParseUint(strVal, 10, 16)
@@ -281,6 +757,37 @@ func getWeightParam(r *http.Request, name string) (uint16, *webapputil.HTTPError
 	return uint16(val), nil
 }
 
+// getVRIDParam parses a VRID. The empty value means zero.
+func getVRIDParam(r *http.Request, name string) (uint8, *webapputil.HTTPError) {
+	strVal := r.Form.Get(name)
+	if strVal == "" {
+		return 0, nil
+	}
+	val, err := strconv.ParseUint(strVal, 10, 8)
+	if err != nil || val == 0 {
+		if err == nil {
+			err = errors.New("zero vrid")
+		}
+		err = ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("vrid must be integer between 1 and 255; %v", err)
+		}).String("name", name).String("value", strVal).Stack("")
+		return 0, webapputil.NewHTTPError(err, http.StatusBadRequest,
+			struct {
+				problem.Problem
+				InvalidParams []invalidParam `json:"invalid-params"`
+			}{
+				Problem: problem.Problem{
+					Type:  "https://goloba.github.io/problems/bad-request",
+					Title: "vrid must be integer between 1 and 255",
+				},
+				InvalidParams: []invalidParam{
+					{Name: name, Value: strVal},
+				},
+			})
+	}
+	return uint8(val), nil
+}
+
 func sendOKResponse(w http.ResponseWriter, r *http.Request, detail interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -300,13 +807,23 @@ func (l *LoadBalancer) handleInfo(w http.ResponseWriter, r *http.Request) {
 	}
 	for i, serviceAndDests := range l.servicesAndDests.services {
 		s := serviceAndDests.service
-		serviceConf := l.config.findService(s.Address, s.Port)
+		serviceConf := l.config.findService(ipvsServiceKey(s))
 		info.Services[i] = api.Service{
-			Protocol:     s.Protocol.String(),
-			Address:      s.Address.String(),
-			Port:         s.Port,
-			Schedule:     s.SchedName,
-			Destinations: make([]api.Destination, len(serviceAndDests.destinations)),
+			AddressFamily: s.AddressFamily.String(),
+			Schedule:      s.SchedName,
+			Destinations:  make([]api.Destination, len(serviceAndDests.destinations)),
+		}
+		if s.Flags.Flags&libipvs.IP_VS_SVC_F_PERSISTENT != 0 {
+			info.Services[i].Persistent = true
+			info.Services[i].PersistenceTimeout = s.Timeout
+			info.Services[i].PersistenceNetmask = ipvsNetmaskPrefixLen(s.AddressFamily, s.Netmask)
+		}
+		if s.FWMark != 0 {
+			info.Services[i].FWMark = s.FWMark
+		} else {
+			info.Services[i].Protocol = s.Protocol.String()
+			info.Services[i].Address = s.Address.String()
+			info.Services[i].Port = s.Port
 		}
 		for j, dest := range serviceAndDests.destinations {
 			d := dest.destination
@@ -321,10 +838,22 @@ func (l *LoadBalancer) handleInfo(w http.ResponseWriter, r *http.Request) {
 				InactiveConn:  d.InactConns,
 				Detached:      destConf.Detached,
 				Locked:        destConf.Locked,
+				SuccessStreak: destConf.successStreak,
+				FailureStreak: destConf.failureStreak,
+				SlowStart:     destConf.slowStartProgress(),
+				Draining:      destConf.draining,
 			}
 		}
 	}
 	l.mu.RUnlock()
 
+	for _, n := range l.vrrpNodes {
+		info.VRRP = append(info.VRRP, api.VRRPInstance{
+			Name:     n.Name,
+			VRID:     n.VRID,
+			Priority: n.priority(),
+			State:    n.state().String(),
+		})
+	}
 	sendOKResponse(w, r, info)
 }
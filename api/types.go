@@ -1,16 +1,82 @@
 package api
 
+import "time"
+
 // Info represents the result of /info API
 type Info struct {
-	Services []Service `json:"services"`
+	Services []Service      `json:"services"`
+	VRRP     []VRRPInstance `json:"vrrp,omitempty"`
+}
+
+// VRRPInstance represents the state of a VRRP instance in the result of /info API.
+type VRRPInstance struct {
+	Name     string `json:"name,omitempty"`
+	VRID     uint8  `json:"vrid"`
+	Priority uint8  `json:"priority"`
+	State    string `json:"state"`
 }
 
+// Service represents a virtual service. FWMark is set for a firewall mark
+// service, and Protocol, Address and Port are set for other services.
 type Service struct {
-	Protocol     string        `json:"protocol"`
-	Address      string        `json:"address"`
-	Port         uint16        `json:"port"`
-	Schedule     string        `json:"schedule"`
-	Destinations []Destination `json:"destinations"`
+	Protocol      string        `json:"protocol,omitempty"`
+	Address       string        `json:"address,omitempty"`
+	Port          uint16        `json:"port,omitempty"`
+	FWMark        uint32        `json:"fwmark,omitempty"`
+	AddressFamily string        `json:"address_family"`
+	Schedule      string        `json:"schedule"`
+	Destinations  []Destination `json:"destinations"`
+
+	// PersistenceTimeout is in seconds, and PersistenceNetmask is a prefix length.
+	Persistent         bool   `json:"persistent"`
+	PersistenceTimeout uint32 `json:"persistence_timeout,omitempty"`
+	PersistenceNetmask uint8  `json:"persistence_netmask,omitempty"`
+}
+
+// HA represents the result of /ha API. Nodes has the status of each VRRP
+// instance.
+type HA struct {
+	Enabled bool     `json:"enabled"`
+	Nodes   []HANode `json:"nodes"`
+}
+
+// HANode represents the VRRP status of a node. Durations are in seconds.
+type HANode struct {
+	Name               string    `json:"name,omitempty"`
+	State              string    `json:"state"`
+	VRID               uint8     `json:"vrid"`
+	Priority           uint8     `json:"priority"`
+	BasePriority       uint8     `json:"base_priority"`
+	Preempt            bool      `json:"preempt"`
+	LocalAddress       string    `json:"local_address"`
+	PeerAddress        string    `json:"peer_address"`
+	Since              time.Time `json:"since"`
+	TimeInState        float64   `json:"time_in_state"`
+	Transitions        uint64    `json:"transitions"`
+	Sent               uint64    `json:"sent"`
+	Received           uint64    `json:"received"`
+	Rejected           uint64    `json:"rejected"`
+	MasterDownInterval float64   `json:"master_down_interval"`
+	Maintenance        bool      `json:"maintenance"`
+
+	// LastAdvert is the time when the last advertisement was received from
+	// the peer, and it is nil if none has been received.
+	LastAdvert         *time.Time `json:"last_advert,omitempty"`
+	LastAdvertPriority uint8      `json:"last_advert_priority,omitempty"`
+
+	// Peers is the status of advertisements from each peer.
+	Peers []HAPeer `json:"peers,omitempty"`
+
+	VIPInterface string   `json:"vip_interface"`
+	VIPs         []string `json:"vips"`
+	HeldVIPs     []string `json:"held_vips"`
+}
+
+// HAPeer represents the status of advertisements from a VRRP peer.
+type HAPeer struct {
+	Address            string     `json:"address"`
+	LastAdvert         *time.Time `json:"last_advert,omitempty"`
+	LastAdvertPriority uint8      `json:"last_advert_priority,omitempty"`
 }
 
 type Destination struct {
@@ -23,4 +89,15 @@ type Destination struct {
 	InactiveConn  uint32 `json:"inactive_conn"`
 	Detached      bool   `json:"detached"`
 	Locked        bool   `json:"locked"`
+
+	// SuccessStreak and FailureStreak are the numbers of consecutive
+	// successful and failed health checks.
+	SuccessStreak int `json:"success_streak"`
+	FailureStreak int `json:"failure_streak"`
+
+	// SlowStart is the progress of the slow start in percent, or zero if
+	// the weight is not being ramped up.
+	SlowStart int `json:"slow_start,omitempty"`
+
+	Draining bool `json:"draining"`
 }
@@ -0,0 +1,28 @@
+package goloba
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleHAFailoverPreempt(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, time.Second)
+	defer cleanup()
+	n.becomeMaster()
+	l := &LoadBalancer{vrrpNodes: []*haNode{n}}
+
+	// The request is rejected before the run loop of the node is asked, so
+	// the node is not running here.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/ha/failover", nil)
+	wrapWithErrHandler(l.handleHAFailover).ServeHTTP(w, r)
+	if w.Code != http.StatusConflict {
+		t.Errorf("status: got=%d, want=%d", w.Code, http.StatusConflict)
+	}
+	if got := n.state(); got != haMaster {
+		t.Errorf("state: got=%v, want=%v", got, haMaster)
+	}
+}
@@ -0,0 +1,248 @@
+package goloba
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+// Checker checks the health of a destination.
+// Check is called at each interval of the health check with a context
+// which is canceled when the timeout of the health check expires.
+type Checker interface {
+	Check(ctx context.Context) (ok bool, err error)
+}
+
+// CheckerConfig is the configuration passed to a CheckerFactory.
+type CheckerConfig struct {
+	DestinationAddress net.IP
+	DestinationPort    uint16
+	HealthCheck        HealthCheckConfig
+}
+
+// CheckerFactory creates a Checker for a destination.
+type CheckerFactory func(config *CheckerConfig) (Checker, error)
+
+var (
+	checkerFactoriesMu sync.RWMutex
+	checkerFactories   = map[string]CheckerFactory{
+		healthcheckTypeHTTP: newHTTPChecker,
+		healthcheckTypeTCP:  newTCPChecker,
+	}
+)
+
+const (
+	healthcheckTypeHTTP = "http"
+	healthcheckTypeTCP  = "tcp"
+)
+
+// RegisterChecker registers a CheckerFactory for a health check type,
+// which is specified with health_check.type in the config.
+// Library users must call it before LoadConfig and New.
+// It panics if factory is nil or the type is already registered.
+func RegisterChecker(checkType string, factory CheckerFactory) {
+	checkerFactoriesMu.Lock()
+	defer checkerFactoriesMu.Unlock()
+	if factory == nil {
+		panic("goloba: RegisterChecker factory is nil")
+	}
+	if _, dup := checkerFactories[checkType]; dup {
+		panic("goloba: RegisterChecker called twice for type " + checkType)
+	}
+	checkerFactories[checkType] = factory
+}
+
+// lookupCheckerFactory returns the CheckerFactory for the health check type.
+// The empty type means http.
+func lookupCheckerFactory(checkType string) (CheckerFactory, bool) {
+	if checkType == "" {
+		checkType = healthcheckTypeHTTP
+	}
+	checkerFactoriesMu.RLock()
+	defer checkerFactoriesMu.RUnlock()
+	factory, ok := checkerFactories[checkType]
+	return factory, ok
+}
+
+func newChecker(config *CheckerConfig) (Checker, error) {
+	factory, ok := lookupCheckerFactory(config.HealthCheck.Type)
+	if !ok {
+		return nil, ltsvlog.Err(fmt.Errorf("unsupported health check type %q", config.HealthCheck.Type)).
+			String("type", config.HealthCheck.Type).Stack("")
+	}
+	return factory(config)
+}
+
+// healthCheckTemplateData is the data for the placeholders such as
+// {{.DestAddress}} in URL, HostHeader and ExpectBody of the health check.
+// DestHostPort is for an IPv6 destination in URL.
+type healthCheckTemplateData struct {
+	DestAddress    string
+	DestPort       uint16
+	DestHostPort   string
+	ServiceAddress string
+	ServicePort    uint16
+}
+
+func newHealthCheckTemplateData(serviceConf *ServiceConfig, destConf *DestinationConfig) *healthCheckTemplateData {
+	destIP := net.IP(destConf.Address)
+	data := &healthCheckTemplateData{
+		DestAddress:  destIP.String(),
+		DestPort:     destConf.Port,
+		DestHostPort: net.JoinHostPort(destIP.String(), strconv.Itoa(int(destConf.Port))),
+		ServicePort:  serviceConf.Port,
+	}
+	if serviceConf.Address != nil {
+		data.ServiceAddress = net.IP(serviceConf.Address).String()
+	}
+	return data
+}
+
+// expandTemplates expands the placeholders in URL, HostHeader and ExpectBody.
+func (c *HealthCheckConfig) expandTemplates(data *healthCheckTemplateData) error {
+	for _, f := range []struct {
+		name string
+		s    *string
+	}{
+		{"url", &c.URL},
+		{"host_header", &c.HostHeader},
+		{"expect_body", &c.ExpectBody},
+	} {
+		if !strings.Contains(*f.s, "{{") {
+			continue
+		}
+		t, err := template.New(f.name).Option("missingkey=error").Parse(*f.s)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return err
+		}
+		*f.s = buf.String()
+	}
+	return nil
+}
+
+// maxExpectBodySize is the maximum size of the response body to be read
+// for ExpectBody.
+const maxExpectBodySize = 1 << 20
+
+// httpChecker checks the destination is healthy if the response status
+// for the health check URL is the OK status, and the body contains
+// expectBody if it is not empty.
+type httpChecker struct {
+	method     string
+	url        string
+	hostHeader string
+	okStatus   int
+	expectBody string
+	client     *http.Client
+}
+
+func newHTTPChecker(config *CheckerConfig) (Checker, error) {
+	c := config.HealthCheck
+	return &httpChecker{
+		method:     http.MethodGet,
+		url:        c.URL,
+		hostHeader: c.HostHeader,
+		okStatus:   c.OKStatus,
+		expectBody: c.ExpectBody,
+		client: &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return errors.New("no redirect allowed for healthcheck")
+			},
+			Timeout: c.Timeout,
+			Transport: &http.Transport{
+				DisableKeepAlives: !c.EnableKeepAlive,
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: c.SkipVerifyCert},
+			},
+		},
+	}, nil
+}
+
+func (c *httpChecker) Check(ctx context.Context) (bool, error) {
+	req, err := http.NewRequest(c.method, c.url, nil)
+	if err != nil {
+		return false, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to create request, err=%v", err)
+		}).String("method", c.method).String("url", c.url).Stack("")
+	}
+	req = req.WithContext(ctx)
+	if c.hostHeader != "" {
+		req.Host = c.hostHeader
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to send request, err=%v", err)
+		}).String("method", c.method).String("url", c.url).Stack("")
+	}
+	defer resp.Body.Close()
+
+	ok := resp.StatusCode == c.okStatus
+	if !ok {
+		ltsvlog.Logger.Info().String("msg", "healthcheck status unmatch").Int("status", resp.StatusCode).Int("okStatus", c.okStatus).Log()
+	}
+	if c.expectBody != "" {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxExpectBodySize))
+		if err != nil {
+			return false, ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to read response body, err=%v", err)
+			}).String("method", c.method).String("url", c.url).Stack("")
+		}
+		if ok && !bytes.Contains(body, []byte(c.expectBody)) {
+			ltsvlog.Logger.Info().String("msg", "healthcheck body unmatch").String("url", c.url).String("expectBody", c.expectBody).Log()
+			ok = false
+		}
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		return ok, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to read response body, err=%v", err)
+		}).String("method", c.method).String("url", c.url).Stack("")
+	}
+	return ok, nil
+}
+
+// tcpChecker checks the destination is healthy if a TCP connection can be
+// established to the destination address and the health check port, or the
+// destination port if the health check port is zero.
+type tcpChecker struct {
+	address string
+}
+
+func newTCPChecker(config *CheckerConfig) (Checker, error) {
+	port := config.HealthCheck.Port
+	if port == 0 {
+		port = config.DestinationPort
+	}
+	return &tcpChecker{
+		address: net.JoinHostPort(config.DestinationAddress.String(), strconv.Itoa(int(port))),
+	}, nil
+}
+
+func (c *tcpChecker) Check(ctx context.Context) (bool, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return false, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to connect, err=%v", err)
+		}).String("address", c.address).Stack("")
+	}
+	conn.Close()
+	return true, nil
+}
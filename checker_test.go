@@ -0,0 +1,91 @@
+package goloba
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/hnakamur/netutil"
+)
+
+func newTestTemplateData(serviceAddr, destAddr string) *healthCheckTemplateData {
+	s := &ServiceConfig{Address: netutil.IP(net.ParseIP(serviceAddr)), Port: 80}
+	d := &DestinationConfig{Address: netutil.IP(net.ParseIP(destAddr)), Port: 8080}
+	return newHealthCheckTemplateData(s, d)
+}
+
+func TestExpandTemplates(t *testing.T) {
+	testCases := []struct {
+		template string
+		destAddr string
+		want     string
+	}{
+		{"{{.DestAddress}}", "192.0.2.11", "192.0.2.11"},
+		{"{{.DestPort}}", "192.0.2.11", "8080"},
+		{"{{.DestHostPort}}", "192.0.2.11", "192.0.2.11:8080"},
+		{"{{.DestHostPort}}", "2001:db8::11", "[2001:db8::11]:8080"},
+		{"{{.ServiceAddress}}", "192.0.2.11", "192.0.2.1"},
+		{"{{.ServicePort}}", "192.0.2.11", "80"},
+		{"localhost", "192.0.2.11", "localhost"},
+	}
+	for _, tc := range testCases {
+		data := newTestTemplateData("192.0.2.1", tc.destAddr)
+		c := HealthCheckConfig{
+			URL:        "http://" + tc.template + "/",
+			HostHeader: tc.template + ".example.com",
+			ExpectBody: "ok " + tc.template,
+		}
+		if err := c.expandTemplates(data); err != nil {
+			t.Errorf("%s: expandTemplates: unexpected error %v", tc.template, err)
+			continue
+		}
+		if want := "http://" + tc.want + "/"; c.URL != want {
+			t.Errorf("%s: url unmatch, got=%s, want=%s", tc.template, c.URL, want)
+		}
+		if want := tc.want + ".example.com"; c.HostHeader != want {
+			t.Errorf("%s: host_header unmatch, got=%s, want=%s", tc.template, c.HostHeader, want)
+		}
+		if want := "ok " + tc.want; c.ExpectBody != want {
+			t.Errorf("%s: expect_body unmatch, got=%s, want=%s", tc.template, c.ExpectBody, want)
+		}
+	}
+}
+
+func TestExpandTemplatesError(t *testing.T) {
+	data := newTestTemplateData("192.0.2.1", "192.0.2.11")
+	testCases := []struct {
+		config HealthCheckConfig
+		want   string
+	}{
+		{HealthCheckConfig{URL: "http://{{.NoSuchField}}/"}, "url"},
+		{HealthCheckConfig{HostHeader: "{{.DestAddress"}, "host_header"},
+		{HealthCheckConfig{ExpectBody: "{{.DestAddress | nosuchfunc}}"}, "expect_body"},
+	}
+	for _, tc := range testCases {
+		c := tc.config
+		err := c.expandTemplates(data)
+		if err == nil {
+			t.Errorf("%+v: expandTemplates: no error", tc.config)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: error %q does not contain %q", tc.config, err, tc.want)
+		}
+	}
+}
+
+func TestValidateHealthCheckTemplate(t *testing.T) {
+	got := validateTestConfig(t, `
+services:
+- address: 192.0.2.1
+  port: 80
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+    health_check:
+      url: http://{{.DestAddr}}/
+`)
+	if len(got) != 1 || !strings.HasPrefix(got[0], "/etc/goloba.yml: services[0].destinations[0].health_check: template: url:") {
+		t.Errorf("errors unmatch, got=%q", got)
+	}
+}
@@ -84,17 +84,29 @@ func main() {
 		done <- struct{}{}
 	}()
 
-	signals := make(chan os.Signal)
-	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-signals
-	switch sig {
-	case syscall.SIGUSR1:
-		ltsvlog.Logger.Info().String("msg", "worker received SIGUSR1, initiating shutdown...").Int("pid", pid).Log()
-		lb.SetKeepVIPsDuringRestart(true)
-		cancel()
-	case syscall.SIGINT, syscall.SIGTERM:
-		ltsvlog.Logger.Info().String("msg", "worker received SIGINT or SIGTERM, initiating shutdown...").Stringer("signal", sig).Int("pid", pid).Log()
-		cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGINT, syscall.SIGTERM)
+	for running := true; running; {
+		sig := <-signals
+		switch sig {
+		case syscall.SIGHUP:
+			// NOTE: SIGHUP to the master restarts the worker, while SIGHUP
+			// to the worker only reloads the config.
+			ltsvlog.Logger.Info().String("msg", "worker received SIGHUP, reloading config...").Int("pid", pid).Log()
+			_, err := lb.ReloadConfig(ctx)
+			if err != nil {
+				ltsvlog.Logger.Err(err)
+			}
+		case syscall.SIGUSR1:
+			ltsvlog.Logger.Info().String("msg", "worker received SIGUSR1, initiating shutdown...").Int("pid", pid).Log()
+			lb.SetKeepVIPsDuringRestart(true)
+			cancel()
+			running = false
+		case syscall.SIGINT, syscall.SIGTERM:
+			ltsvlog.Logger.Info().String("msg", "worker received SIGINT or SIGTERM, initiating shutdown...").Stringer("signal", sig).Int("pid", pid).Log()
+			cancel()
+			running = false
+		}
 	}
 	<-done
 	ltsvlog.Logger.Info().String("msg", "goloba worker stopped").Int("pid", pid).Log()
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -25,6 +26,10 @@ const (
 Commands:
   info     show information
   weight   change destination weight
+  reload   reload config of goloba
+  drain    drain destination
+  ha       show VRRP status, or change it with
+           "ha failover" or "ha maintenance on|off"
 
 Globals Options:
 `
@@ -73,6 +78,12 @@ func main() {
 		app.infoCommand(args[1:])
 	case "weight":
 		app.weightCommand(args[1:])
+	case "reload":
+		app.reloadCommand(args[1:])
+	case "drain":
+		app.drainCommand(args[1:])
+	case "ha":
+		app.haCommand(args[1:])
 	default:
 		flag.Usage()
 		os.Exit(1)
@@ -166,10 +177,26 @@ func (a *cliApp) infoCommand(args []string) {
 				//   -> 192.168.122.240:443          masq    20        20        false    false  0          0
 				var buf []byte
 				buf = append(append(buf, s.URL...), '\n')
+				for _, v := range info.VRRP {
+					buf = append(buf, fmt.Sprintf("VRRP vrid %d %s priority %d", v.VRID, v.State, v.Priority)...)
+					if v.Name != "" {
+						buf = append(buf, fmt.Sprintf(" (%s)", v.Name)...)
+					}
+					buf = append(buf, '\n')
+				}
 				buf = append(buf, "Prot LocalAddress:Port Scheduler Flags\n"...)
 				buf = append(buf, "  -> RemoteAddress:Port           Forward CfgWeight CurWeight Detached Locked ActiveConn InActConn\n"...)
 				for _, sr := range info.Services {
-					buf = append(buf, fmt.Sprintf("%-4s %s:%d %s\n", sr.Protocol, sr.Address, sr.Port, sr.Schedule)...)
+					if sr.FWMark != 0 {
+						buf = append(buf, fmt.Sprintf("%-4s %d/%s %s", "fwm", sr.FWMark, sr.AddressFamily, sr.Schedule)...)
+					} else {
+						hostPort := net.JoinHostPort(sr.Address, strconv.Itoa(int(sr.Port)))
+						buf = append(buf, fmt.Sprintf("%-4s %s %s", sr.Protocol, hostPort, sr.Schedule)...)
+					}
+					if sr.Persistent {
+						buf = append(buf, fmt.Sprintf(" persistent %d mask /%d", sr.PersistenceTimeout, sr.PersistenceNetmask)...)
+					}
+					buf = append(buf, '\n')
 					for _, d := range sr.Destinations {
 						hostPort := net.JoinHostPort(d.Address, strconv.Itoa(int(d.Port)))
 						buf = append(buf, fmt.Sprintf("  -> %-28s %-7s %-9d %-9d %-8v %-6v %-10d %-9d\n", hostPort, d.Forward, d.ConfigWeight, d.CurrentWeight, d.Detached, d.Locked, d.ActiveConn, d.InactiveConn)...)
@@ -185,7 +212,7 @@ func (a *cliApp) infoCommand(args []string) {
 func (a *cliApp) weightCommand(args []string) {
 	fs := flag.NewFlagSet("weight", flag.ExitOnError)
 	fs.Usage = subcommandUsageFunc("weight", fs)
-	serviceAddr := fs.String("s", "", "service address in <IPAddress>:<port> form")
+	serviceAddr := fs.String("s", "", "service address in [<protocol>/]<IPAddress>:<port> form, protocol is tcp (default), udp or sctp,\nor firewall mark in [<addressFamily>/]fwmark:<mark> form, addressFamily is inet (default) or inet6")
 	destAddr := fs.String("d", "", "destination address in <IPAddress>:<port> form")
 	weight := fs.Uint("w", 100, fmt.Sprintf("destination weight 0-%d", goloba.MaxWeight))
 	lock := fs.Bool("lock", false, "lock weight regardless of future healthcheck results")
@@ -223,3 +250,249 @@ func (a *cliApp) weightCommand(args []string) {
 	}
 	wg.Wait()
 }
+
+func (a *cliApp) reloadCommand(args []string) {
+	fs := flag.NewFlagSet("reload", flag.ExitOnError)
+	fs.Usage = subcommandUsageFunc("reload", fs)
+	fs.Parse(args)
+
+	var wg sync.WaitGroup
+	for _, s := range a.config.APIServers {
+		wg.Add(1)
+		s := s
+		go func() {
+			defer wg.Done()
+
+			u := fmt.Sprintf("%s/config/reload", s.URL)
+			resp, err := a.httpClient.Post(u, "", nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send request; %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to read response from goloba API server")
+				}).String("serverURL", s.URL).Stack(""))
+			}
+			fmt.Printf("%s:\n%s\n", s.URL, string(data))
+		}()
+	}
+	wg.Wait()
+}
+
+func (a *cliApp) drainCommand(args []string) {
+	fs := flag.NewFlagSet("drain", flag.ExitOnError)
+	fs.Usage = subcommandUsageFunc("drain", fs)
+	serviceAddr := fs.String("s", "", "service address in the same form as weight command")
+	destAddr := fs.String("d", "", "destination address in <IPAddress>:<port> form")
+	wait := fs.Bool("wait", false, "wait until active connections reach zero or timeout expires")
+	timeout := fs.Duration("timeout", time.Minute, "timeout for waiting")
+	remove := fs.Bool("remove", false, "remove destination after drained")
+	fs.Parse(args)
+
+	client := a.httpClient
+	if *wait {
+		client = &http.Client{Timeout: *timeout + a.config.Timeout}
+	}
+
+	var wg sync.WaitGroup
+	for _, s := range a.config.APIServers {
+		wg.Add(1)
+		s := s
+		go func() {
+			defer wg.Done()
+
+			form := url.Values{}
+			form.Set("service", *serviceAddr)
+			form.Set("dest", *destAddr)
+			form.Set("wait", strconv.FormatBool(*wait))
+			form.Set("timeout", timeout.String())
+			form.Set("remove", strconv.FormatBool(*remove))
+			resp, err := client.PostForm(fmt.Sprintf("%s/drain", s.URL), form)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send request; %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to read response from goloba API server")
+				}).String("serverURL", s.URL).Stack(""))
+			}
+			fmt.Printf("%s:\n%s\n", s.URL, string(data))
+		}()
+	}
+	wg.Wait()
+}
+
+func (a *cliApp) haCommand(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "failover":
+			a.haControlCommand("failover", "/ha/failover", nil, args[1:])
+			return
+		case "maintenance":
+			if len(args) < 2 || (args[1] != "on" && args[1] != "off") {
+				flag.Usage()
+				os.Exit(1)
+			}
+			form := url.Values{}
+			form.Set("enable", strconv.FormatBool(args[1] == "on"))
+			a.haControlCommand("maintenance", "/ha/maintenance", form, args[2:])
+			return
+		}
+	}
+
+	fs := flag.NewFlagSet("ha", flag.ExitOnError)
+	fs.Usage = subcommandUsageFunc("ha", fs)
+	format := fs.String("format", "text", "result format, 'text' or 'json'")
+	fs.Parse(args)
+
+	results := make([]*api.HA, len(a.config.APIServers))
+	var wg sync.WaitGroup
+	for i, s := range a.config.APIServers {
+		wg.Add(1)
+		i, s := i, s
+		go func() {
+			defer wg.Done()
+
+			u := fmt.Sprintf("%s/ha", s.URL)
+			resp, err := a.httpClient.Get(u)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to send request; %v\n", err)
+				return
+			}
+			defer resp.Body.Close()
+
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to read response from goloba API server")
+				}).String("serverURL", s.URL).Stack(""))
+			}
+			if *format == "json" {
+				fmt.Printf("%s:\n%s\n", s.URL, string(data))
+				return
+			}
+			var ha api.HA
+			err = json.Unmarshal(data, &ha)
+			if err != nil {
+				ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to unmarshal JSON response from goloba API server")
+				}).String("serverURL", s.URL).Stack(""))
+				return
+			}
+			results[i] = &ha
+		}()
+	}
+	wg.Wait()
+	if *format != "text" {
+		return
+	}
+
+	var buf []byte
+	buf = append(buf, "VRID State    Prio Local           Peer            InState    LastAdvert MasterDown Maint HeldVIPs\n"...)
+	masters := make(map[uint8][]string)
+	for i, s := range a.config.APIServers {
+		ha := results[i]
+		if ha == nil {
+			continue
+		}
+		buf = append(append(buf, s.URL...), '\n')
+		if !ha.Enabled {
+			buf = append(buf, "  VRRP is disabled\n"...)
+			continue
+		}
+		for _, n := range ha.Nodes {
+			lastAdvert := "-"
+			if n.LastAdvert != nil {
+				lastAdvert = fmt.Sprintf("%s ago", truncateDuration(time.Since(*n.LastAdvert), time.Millisecond))
+			}
+			buf = append(buf, fmt.Sprintf("%-4d %-8s %-4d %-15s %-15s %-10s %-10s %-10s %-5v %s\n",
+				n.VRID, n.State, n.Priority, n.LocalAddress, n.PeerAddress,
+				truncateDuration(secondsToDuration(n.TimeInState), time.Second), lastAdvert,
+				secondsToDuration(n.MasterDownInterval), n.Maintenance, strings.Join(n.HeldVIPs, ","))...)
+			if len(n.Peers) > 1 {
+				for _, p := range n.Peers {
+					lastAdvert := "-"
+					if p.LastAdvert != nil {
+						lastAdvert = fmt.Sprintf("%s ago", truncateDuration(time.Since(*p.LastAdvert), time.Millisecond))
+					}
+					buf = append(buf, fmt.Sprintf("     peer %-15s last advert %s\n", p.Address, lastAdvert)...)
+				}
+			}
+			if n.State == "master" {
+				masters[n.VRID] = append(masters[n.VRID], s.URL)
+			}
+		}
+	}
+	for vrid, urls := range masters {
+		if len(urls) > 1 {
+			buf = append(buf, fmt.Sprintf("WARNING: multiple masters for VRID %d: %s\n", vrid, strings.Join(urls, ", "))...)
+		}
+	}
+	os.Stdout.Write(buf)
+}
+
+func (a *cliApp) haControlCommand(name, path string, form url.Values, args []string) {
+	fs := flag.NewFlagSet("ha "+name, flag.ExitOnError)
+	fs.Usage = subcommandUsageFunc("ha "+name, fs)
+	serverURL := fs.String("server", "", "URL of API server to send request to, required if multiple servers are in config")
+	vrid := fs.Uint("vrid", 0, "VRID of VRRP instance, all instances if zero")
+	fs.Parse(args)
+
+	// Failover or maintenance on all nodes at once would leave no master,
+	// so the request is sent to exactly one server.
+	var server *apiServerConfig
+	for i := range a.config.APIServers {
+		s := &a.config.APIServers[i]
+		if *serverURL == "" || s.URL == *serverURL {
+			if server != nil {
+				fmt.Fprintf(os.Stderr, "-server must be specified for \"ha %s\" since multiple API servers are in config\n", name)
+				os.Exit(1)
+			}
+			server = s
+		}
+	}
+	if server == nil {
+		fmt.Fprintf(os.Stderr, "API server not found in config; %q\n", *serverURL)
+		os.Exit(1)
+	}
+
+	if form == nil {
+		form = url.Values{}
+	}
+	if *vrid != 0 {
+		form.Set("vrid", strconv.FormatUint(uint64(*vrid), 10))
+	}
+
+	resp, err := a.httpClient.PostForm(server.URL+path, form)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to send request; %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		ltsvlog.Err(ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to read response from goloba API server")
+		}).String("serverURL", server.URL).Stack(""))
+	}
+	fmt.Printf("%s:\n%s\n", server.URL, string(data))
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// truncateDuration rounds d toward zero to a multiple of m.
+// time.Duration.Truncate is not used since it requires Go 1.9.
+func truncateDuration(d, m time.Duration) time.Duration {
+	return d - d%m
+}
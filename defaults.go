@@ -0,0 +1,164 @@
+package goloba
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultsConfig is the defaults for the fields of services and health
+// checks which are not set in the config.
+type DefaultsConfig struct {
+	Schedule    string            `yaml:"schedule"`
+	Type        string            `yaml:"type"`
+	HealthCheck HealthCheckConfig `yaml:"health_check"`
+}
+
+// builtinDefaults is used for the fields which are set in neither the config
+// nor the defaults.
+var builtinDefaults = DefaultsConfig{
+	Schedule: "wlc",
+	Type:     "nat",
+	HealthCheck: HealthCheckConfig{
+		OKStatus: 200,
+		Timeout:  time.Second,
+		Interval: 3 * time.Second,
+	},
+}
+
+// applyDefaults sets the fields of services and health checks which are not
+// set with c.Defaults.
+func (c *Config) applyDefaults() {
+	c.Defaults.HealthCheck.location = configLocation{file: c.file, path: "defaults.health_check"}
+	for i := range c.Services {
+		s := &c.Services[i]
+		s.HealthCheckDefaults.location = configLocation{file: c.file, path: fmt.Sprintf("services[%d].health_check_defaults", i)}
+		s.applyDefaults(&c.Defaults)
+	}
+}
+
+// applyDefaults sets the fields of the service and the health checks which
+// are not set. A health check field is taken from health_check_defaults of
+// the service, d and the built-in defaults in this order.
+func (s *ServiceConfig) applyDefaults(d *DefaultsConfig) {
+	if s.Schedule == "" {
+		s.Schedule = d.Schedule
+	}
+	if s.Schedule == "" {
+		s.Schedule = builtinDefaults.Schedule
+	}
+	if s.Type == "" {
+		s.Type = d.Type
+	}
+	if s.Type == "" {
+		s.Type = builtinDefaults.Type
+	}
+	for j := range s.Destinations {
+		h := &s.Destinations[j].HealthCheck
+		h.merge(&s.HealthCheckDefaults)
+		h.merge(&d.HealthCheck)
+		h.merge(&builtinDefaults.HealthCheck)
+	}
+}
+
+// merge sets the fields of c which are not set to the ones of d.
+func (c *DefaultsConfig) merge(d *DefaultsConfig) {
+	if c.Schedule == "" {
+		c.Schedule = d.Schedule
+	}
+	if c.Type == "" {
+		c.Type = d.Type
+	}
+	c.HealthCheck.merge(&d.HealthCheck)
+}
+
+// merge sets the fields of c which are the zero values to the ones of d.
+// A bool field set to false in the config is kept. Params are merged by key.
+// The locations of the validated fields taken from d are recorded so that
+// errors in them are reported at the defaults block.
+func (c *HealthCheckConfig) merge(d *HealthCheckConfig) {
+	if c.Type == "" && d.Type != "" {
+		c.Type = d.Type
+		c.inherit(d, "type")
+	}
+	if c.Port == 0 {
+		c.Port = d.Port
+	}
+	if c.URL == "" && d.URL != "" {
+		c.URL = d.URL
+		c.inherit(d, "url")
+	}
+	if c.HostHeader == "" {
+		c.HostHeader = d.HostHeader
+	}
+	if c.ExpectBody == "" {
+		c.ExpectBody = d.ExpectBody
+	}
+	if !c.EnableKeepAlive && !c.enableKeepAliveSet {
+		c.EnableKeepAlive = d.EnableKeepAlive
+		c.enableKeepAliveSet = d.enableKeepAliveSet
+	}
+	if !c.SkipVerifyCert && !c.skipVerifyCertSet {
+		c.SkipVerifyCert = d.SkipVerifyCert
+		c.skipVerifyCertSet = d.skipVerifyCertSet
+	}
+	if c.OKStatus == 0 {
+		c.OKStatus = d.OKStatus
+	}
+	if c.Timeout == 0 && d.Timeout != 0 {
+		c.Timeout = d.Timeout
+		c.inherit(d, "timeout")
+	}
+	if c.Interval == 0 && d.Interval != 0 {
+		c.Interval = d.Interval
+		c.inherit(d, "interval")
+	}
+	if c.Rise == 0 && d.Rise != 0 {
+		c.Rise = d.Rise
+		c.inherit(d, "rise")
+	}
+	if c.Fall == 0 && d.Fall != 0 {
+		c.Fall = d.Fall
+		c.inherit(d, "fall")
+	}
+	if len(d.Params) > 0 {
+		params := make(map[string]string, len(c.Params)+len(d.Params))
+		for k, v := range d.Params {
+			params[k] = v
+		}
+		for k, v := range c.Params {
+			params[k] = v
+		}
+		c.Params = params
+	}
+}
+
+// configLocation is the file and the YAML path of a value in the config.
+// file is empty for the main config file when it is not known.
+type configLocation struct {
+	file string
+	path string
+}
+
+// inherit records that the field of c is taken from d.
+func (c *HealthCheckConfig) inherit(d *HealthCheckConfig, field string) {
+	loc, ok := d.origins[field]
+	if !ok {
+		if d.location.path == "" {
+			return
+		}
+		loc = d.location
+	}
+	if c.origins == nil {
+		c.origins = make(map[string]configLocation)
+	}
+	c.origins[field] = loc
+}
+
+// fieldLocation returns the location of the field of the health check at
+// path. It is the defaults block if the value is taken from it.
+func (c *HealthCheckConfig) fieldLocation(path, field string) configLocation {
+	if loc, ok := c.origins[field]; ok {
+		return configLocation{file: loc.file, path: loc.path + "." + field}
+	}
+	return configLocation{path: path + "." + field}
+}
@@ -0,0 +1,199 @@
+package goloba
+
+import (
+	"testing"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	testCases := []struct {
+		name            string
+		config          string
+		schedule        string
+		typ             string
+		okStatus        int
+		timeout         time.Duration
+		interval        time.Duration
+		url             string
+		enableKeepAlive bool
+	}{
+		{
+			name: "builtin",
+			config: `
+services:
+- destinations:
+  - port: 80
+`,
+			schedule: "wlc",
+			typ:      "nat",
+			okStatus: 200,
+			timeout:  time.Second,
+			interval: 3 * time.Second,
+		},
+		{
+			name: "defaults",
+			config: `
+defaults:
+  schedule: rr
+  type: dr
+  health_check:
+    url: http://example.com/
+    ok_status: 204
+    timeout: 2s
+    enable_keep_alive: true
+services:
+- destinations:
+  - port: 80
+`,
+			schedule:        "rr",
+			typ:             "dr",
+			okStatus:        204,
+			timeout:         2 * time.Second,
+			interval:        3 * time.Second,
+			url:             "http://example.com/",
+			enableKeepAlive: true,
+		},
+		{
+			name: "serviceDefaults",
+			config: `
+defaults:
+  health_check:
+    url: http://example.com/
+    timeout: 2s
+services:
+- schedule: sh
+  health_check_defaults:
+    url: http://example.com/service
+    interval: 5s
+  destinations:
+  - port: 80
+`,
+			schedule: "sh",
+			typ:      "nat",
+			okStatus: 200,
+			timeout:  2 * time.Second,
+			interval: 5 * time.Second,
+			url:      "http://example.com/service",
+		},
+		{
+			name: "destination",
+			config: `
+services:
+- health_check_defaults:
+    url: http://example.com/service
+    interval: 5s
+  destinations:
+  - port: 80
+    health_check:
+      url: http://example.com/destination
+      interval: 10s
+`,
+			schedule: "wlc",
+			typ:      "nat",
+			okStatus: 200,
+			timeout:  time.Second,
+			interval: 10 * time.Second,
+			url:      "http://example.com/destination",
+		},
+		{
+			name: "explicitFalse",
+			config: `
+defaults:
+  health_check:
+    enable_keep_alive: true
+services:
+- health_check_defaults:
+    enable_keep_alive: false
+  destinations:
+  - port: 80
+`,
+			schedule:        "wlc",
+			typ:             "nat",
+			okStatus:        200,
+			timeout:         time.Second,
+			interval:        3 * time.Second,
+			enableKeepAlive: false,
+		},
+		{
+			name: "explicitFalseInDestination",
+			config: `
+services:
+- health_check_defaults:
+    enable_keep_alive: true
+  destinations:
+  - port: 80
+    health_check:
+      enable_keep_alive: false
+`,
+			schedule:        "wlc",
+			typ:             "nat",
+			okStatus:        200,
+			timeout:         time.Second,
+			interval:        3 * time.Second,
+			enableKeepAlive: false,
+		},
+	}
+	for _, tc := range testCases {
+		var c Config
+		if err := yaml.UnmarshalStrict([]byte(tc.config), &c); err != nil {
+			t.Fatalf("%s: failed to parse config, err=%v", tc.name, err)
+		}
+		c.applyDefaults()
+
+		s := &c.Services[0]
+		if s.Schedule != tc.schedule {
+			t.Errorf("%s: schedule unmatch, got=%s, want=%s", tc.name, s.Schedule, tc.schedule)
+		}
+		if s.Type != tc.typ {
+			t.Errorf("%s: type unmatch, got=%s, want=%s", tc.name, s.Type, tc.typ)
+		}
+		h := &s.Destinations[0].HealthCheck
+		if h.OKStatus != tc.okStatus {
+			t.Errorf("%s: ok_status unmatch, got=%d, want=%d", tc.name, h.OKStatus, tc.okStatus)
+		}
+		if h.Timeout != tc.timeout {
+			t.Errorf("%s: timeout unmatch, got=%s, want=%s", tc.name, h.Timeout, tc.timeout)
+		}
+		if h.Interval != tc.interval {
+			t.Errorf("%s: interval unmatch, got=%s, want=%s", tc.name, h.Interval, tc.interval)
+		}
+		if h.URL != tc.url {
+			t.Errorf("%s: url unmatch, got=%s, want=%s", tc.name, h.URL, tc.url)
+		}
+		if h.EnableKeepAlive != tc.enableKeepAlive {
+			t.Errorf("%s: enable_keep_alive unmatch, got=%v, want=%v", tc.name, h.EnableKeepAlive, tc.enableKeepAlive)
+		}
+	}
+}
+
+func TestHealthCheckConfigMergeBool(t *testing.T) {
+	d := HealthCheckConfig{EnableKeepAlive: true, SkipVerifyCert: true}
+
+	// A config built in Go without YAML has no explicit false.
+	var c HealthCheckConfig
+	c.merge(&d)
+	if !c.EnableKeepAlive || !c.SkipVerifyCert {
+		t.Errorf("merge: bool defaults not applied, got=%+v", c)
+	}
+
+	var e HealthCheckConfig
+	if err := yaml.UnmarshalStrict([]byte("skip_verify_cert: false\n"), &e); err != nil {
+		t.Fatal(err)
+	}
+	e.merge(&d)
+	if !e.EnableKeepAlive {
+		t.Error("merge: enable_keep_alive default not applied")
+	}
+	if e.SkipVerifyCert {
+		t.Error("merge: explicit skip_verify_cert false overridden")
+	}
+}
+
+func TestHealthCheckConfigUnmarshalStrict(t *testing.T) {
+	var c HealthCheckConfig
+	if err := yaml.UnmarshalStrict([]byte("enable_keep_alive: true\nno_such_field: 1\n"), &c); err == nil {
+		t.Error("UnmarshalStrict: unknown field accepted")
+	}
+}
@@ -0,0 +1,133 @@
+package goloba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+// drainPollInterval is the interval to poll the connection counts of
+// a draining destination.
+const drainPollInterval = time.Second
+
+// drainDestination sets the weight of the destination to zero and locks it,
+// so that new connections are not sent to it while existing connections
+// are kept. The configured weight is kept so that the operator can restore
+// it with the weight API.
+func (l *LoadBalancer) drainDestination(ctx context.Context, destKey string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.loadIPVS()
+	if err != nil {
+		return err
+	}
+
+	dest := l.servicesAndDests.findDestination(destKey)
+	if dest == nil {
+		return ltsvlog.Err(errors.New("no destination found")).String("destKey", destKey).Stack("")
+	}
+	destConf := l.config.findDestination(destKey)
+	if destConf == nil {
+		return ltsvlog.Err(errors.New("no destination config found")).String("destKey", destKey).Stack("")
+	}
+
+	destConf.stopSlowStart()
+	service := dest.service
+	destination := dest.destination
+	destination.Weight = 0
+	err = l.ipvs.UpdateDestination(service, destination)
+	if err != nil {
+		return ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("faild to drain ipvs destination, err=%s", err)
+		}).String("destKey", destKey).Stack("")
+	}
+	destConf.Locked = true
+	destConf.draining = true
+	ltsvlog.Logger.Info().String("msg", "started draining destination").String("destKey", destKey).
+		Uint32("activeConn", destination.ActiveConns).Uint32("inactiveConn", destination.InactConns).Log()
+	return nil
+}
+
+// destinationConns returns the numbers of the active and inactive
+// connections of the destination.
+func (l *LoadBalancer) destinationConns(destKey string) (active, inactive uint32, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err = l.loadIPVS()
+	if err != nil {
+		return 0, 0, err
+	}
+	dest := l.servicesAndDests.findDestination(destKey)
+	if dest == nil {
+		return 0, 0, ltsvlog.Err(errors.New("no destination found")).String("destKey", destKey).Stack("")
+	}
+	return dest.destination.ActiveConns, dest.destination.InactConns, nil
+}
+
+// waitDrained polls the connection counts of the destination until the active
+// connections reach zero or the timeout expires. It returns the last counts.
+func (l *LoadBalancer) waitDrained(ctx context.Context, destKey string, timeout time.Duration) (active, inactive uint32, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active, inactive, err = l.destinationConns(destKey)
+		if err != nil || active == 0 {
+			return active, inactive, err
+		}
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return active, inactive, nil
+		case <-ctx.Done():
+			return active, inactive, ctx.Err()
+		}
+	}
+}
+
+// removeDestination deletes the destination from IPVS and stops its health
+// checker. The destination is kept removed when the config is reloaded, and
+// it is added again only after it is deleted from the config file and then
+// added back, or goloba is restarted.
+func (l *LoadBalancer) removeDestination(ctx context.Context, destKey string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	err := l.loadIPVS()
+	if err != nil {
+		return err
+	}
+	dest := l.servicesAndDests.findDestination(destKey)
+	if dest == nil {
+		return ltsvlog.Err(errors.New("no destination found")).String("destKey", destKey).Stack("")
+	}
+	service := dest.service
+	destination := dest.destination
+	err = l.ipvs.DelDestination(service, destination)
+	if err != nil {
+		return ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("faild delete ipvs destination, err=%v", err)
+		}).String("destKey", destKey).Stack("")
+	}
+
+	// The destination is kept in the config and marked as removed, so that
+	// a reload does not add it again.
+	if destConf := l.config.findDestination(destKey); destConf != nil {
+		destConf.stopSlowStart()
+		destConf.removed = true
+	}
+	l.checkers.stopHealthchecker(destKey)
+
+	err = l.loadIPVS()
+	if err != nil {
+		return err
+	}
+	ltsvlog.Logger.Info().String("msg", "removed drained destination").String("destKey", destKey).Log()
+	return nil
+}
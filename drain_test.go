@@ -0,0 +1,170 @@
+package goloba
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/hnakamur/netutil"
+	"github.com/mqliang/libipvs"
+)
+
+// fakeIPVS is an IPVS handle which has fixed services and destinations,
+// and records the added and updated destinations.
+type fakeIPVS struct {
+	libipvs.IPVSHandle
+	services     []*libipvs.Service
+	destinations map[*libipvs.Service][]*libipvs.Destination
+	added        []*libipvs.Destination
+	updated      []*libipvs.Destination
+}
+
+func (f *fakeIPVS) ListServices() ([]*libipvs.Service, error) {
+	return f.services, nil
+}
+
+func (f *fakeIPVS) ListDestinations(s *libipvs.Service) ([]*libipvs.Destination, error) {
+	return f.destinations[s], nil
+}
+
+func (f *fakeIPVS) UpdateDestination(s *libipvs.Service, d *libipvs.Destination) error {
+	f.updated = append(f.updated, d)
+	return nil
+}
+
+func (f *fakeIPVS) NewDestination(s *libipvs.Service, d *libipvs.Destination) error {
+	f.added = append(f.added, d)
+	return nil
+}
+
+func (f *fakeIPVS) DelDestination(s *libipvs.Service, d *libipvs.Destination) error {
+	dests := f.destinations[s][:0]
+	for _, dest := range f.destinations[s] {
+		if !dest.Address.Equal(d.Address) || dest.Port != d.Port {
+			dests = append(dests, dest)
+		}
+	}
+	f.destinations[s] = dests
+	return nil
+}
+
+func TestReloadKeepsDrainingDestination(t *testing.T) {
+	newConfig := func() *Config {
+		c := &Config{
+			Services: []ServiceConfig{{
+				Address: netutil.IP(net.ParseIP("192.0.2.1")),
+				Port:    80,
+				Destinations: []DestinationConfig{
+					{Address: netutil.IP(net.ParseIP("192.0.2.11")), Port: 8080, Weight: 100},
+				},
+			}},
+		}
+		c.updateDestinations()
+		return c
+	}
+	destKey := "tcp/192.0.2.1:80,192.0.2.11:8080"
+
+	old := newConfig()
+	oldDest := old.findDestination(destKey)
+	oldDest.Locked = true
+	oldDest.draining = true
+
+	config := newConfig()
+	config.inheritRuntimeState(old)
+	destConf := config.findDestination(destKey)
+	if !destConf.Locked || !destConf.draining {
+		t.Fatalf("runtime state after reload: got locked=%v draining=%v, want both true", destConf.Locked, destConf.draining)
+	}
+
+	service := &libipvs.Service{
+		Protocol:      syscall.IPPROTO_TCP,
+		AddressFamily: syscall.AF_INET,
+		Address:       net.ParseIP("192.0.2.1").To4(),
+		Port:          80,
+	}
+	destination := &libipvs.Destination{
+		Address:     net.ParseIP("192.0.2.11").To4(),
+		Port:        8080,
+		FwdMethod:   libipvs.IP_VS_CONN_F_MASQ,
+		Weight:      0,
+		ActiveConns: 3,
+	}
+	ipvs := &fakeIPVS{}
+	l := &LoadBalancer{ipvs: ipvs}
+	serviceAndDests := &ipvsServiceAndDests{
+		service:      service,
+		destinations: []*ipvsDestination{{destination: destination, service: service}},
+	}
+	err := l.addOrUpdateDestination(context.Background(), service, serviceAndDests, &config.Services[0], destConf)
+	if err != nil {
+		t.Fatalf("addOrUpdateDestination: %v", err)
+	}
+	for _, d := range ipvs.updated {
+		if d.Weight != 0 {
+			t.Errorf("draining destination updated to weight %d after reload, want 0", d.Weight)
+		}
+	}
+}
+
+func TestReloadKeepsRemovedDestination(t *testing.T) {
+	newConfig := func() *Config {
+		c := &Config{
+			Services: []ServiceConfig{{
+				Address:  netutil.IP(net.ParseIP("192.0.2.1")),
+				Port:     80,
+				Schedule: "wlc",
+				Type:     "nat",
+				Destinations: []DestinationConfig{
+					{Address: netutil.IP(net.ParseIP("192.0.2.11")), Port: 8080, Weight: 100},
+					{Address: netutil.IP(net.ParseIP("192.0.2.12")), Port: 8080, Weight: 100},
+				},
+			}},
+		}
+		c.updateDestinations()
+		return c
+	}
+	destKey := "tcp/192.0.2.1:80,192.0.2.11:8080"
+
+	service := &libipvs.Service{
+		Protocol:      syscall.IPPROTO_TCP,
+		AddressFamily: syscall.AF_INET,
+		Address:       net.ParseIP("192.0.2.1").To4(),
+		Port:          80,
+		SchedName:     "wlc",
+		Netmask:       ipvsNetmask(syscall.AF_INET, 0),
+	}
+	ipvs := &fakeIPVS{
+		services: []*libipvs.Service{service},
+		destinations: map[*libipvs.Service][]*libipvs.Destination{
+			service: {
+				{Address: net.ParseIP("192.0.2.11").To4(), Port: 8080, FwdMethod: libipvs.IP_VS_CONN_F_MASQ, Weight: 0},
+				{Address: net.ParseIP("192.0.2.12").To4(), Port: 8080, FwdMethod: libipvs.IP_VS_CONN_F_MASQ, Weight: 100},
+			},
+		},
+	}
+	l := &LoadBalancer{ipvs: ipvs, config: newConfig(), checkers: newHealthcheckers()}
+
+	if err := l.removeDestination(context.Background(), destKey); err != nil {
+		t.Fatalf("removeDestination: %v", err)
+	}
+	if got := len(ipvs.destinations[service]); got != 1 {
+		t.Fatalf("destinations in IPVS after remove: got=%d, want=1", got)
+	}
+	if destConf := l.config.findDestination(destKey); destConf == nil || !destConf.removed {
+		t.Fatal("removed destination not kept in config as removed")
+	}
+
+	if err := l.applyConfig(context.Background(), newConfig()); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	if len(ipvs.added) != 0 {
+		t.Errorf("removed destination added again after reload: %v", ipvs.added)
+	}
+	if destConf := l.config.findDestination(destKey); destConf == nil || !destConf.removed {
+		t.Error("removed state not kept after reload")
+	}
+	if destConf := l.config.findDestination(destKey); destConf.receivesTraffic() {
+		t.Error("removed destination receives traffic")
+	}
+}
@@ -0,0 +1,108 @@
+package goloba
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// haAuthMACSize is the size of the truncated HMAC-SHA256 in an
+	// authenticated advertisement.
+	haAuthMACSize = 16
+
+	// haAuthTrailerSize is the size of the authentication trailer, which is
+	// a 64 bit counter followed by the MAC, appended to an advertisement.
+	haAuthTrailerSize = 8 + haAuthMACSize
+)
+
+// haAuth authenticates advertisements with a shared secret. The sender
+// appends a monotonic counter and an HMAC over its source address, the VRID,
+// the VRRP message and the counter, and the receiver rejects a bad MAC or
+// a counter which is not greater than the last one from the same source.
+//
+// The counter is not stored on disk. It starts from the current time in
+// nanoseconds, which is greater than any counter sent before a restart as
+// long as the clock does not step backwards. If it does, peers reject the
+// advertisements of the restarted node as replayed until the clock passes
+// the time of the last advertisement before the restart.
+type haAuth struct {
+	key         []byte
+	sendCounter uint64
+	// lastCounters is keyed by the source address and VRID, and it is
+	// accessed only by the receiving goroutine.
+	lastCounters map[string]uint64
+}
+
+func newHAAuth(key string) *haAuth {
+	if key == "" {
+		return nil
+	}
+	return &haAuth{
+		key: []byte(key),
+		// Start with the current time so that the counter keeps increasing
+		// across restarts.
+		sendCounter:  uint64(time.Now().UnixNano()),
+		lastCounters: make(map[string]uint64),
+	}
+}
+
+// haAuthError is returned by ipHAConn.receive for an advertisement which is
+// rejected by the authentication.
+type haAuthError struct {
+	src    net.IP
+	vrid   uint8
+	reason string
+}
+
+func (e *haAuthError) Error() string {
+	return fmt.Sprintf("rejected VRRP advertisement from %s for vrid %d: %s", e.src, e.vrid, e.reason)
+}
+
+// trailer returns the authentication trailer for msg sent from src. msg is
+// the VRRP message with the checksum field set to zero.
+func (a *haAuth) trailer(msg []byte, src net.IP) []byte {
+	counter := atomic.AddUint64(&a.sendCounter, 1)
+	t := make([]byte, 8, haAuthTrailerSize)
+	binary.BigEndian.PutUint64(t, counter)
+	return append(t, a.mac(msg, src, counter)...)
+}
+
+// verify verifies the trailer for msg from src.
+func (a *haAuth) verify(msg, trailer []byte, src net.IP) error {
+	vrid := msg[1]
+	if len(trailer) != haAuthTrailerSize {
+		return &haAuthError{src: src, vrid: vrid, reason: "no authentication data, auth_key may not be configured on the peer"}
+	}
+	counter := binary.BigEndian.Uint64(trailer[:8])
+	if !hmac.Equal(trailer[8:], a.mac(msg, src, counter)) {
+		return &haAuthError{src: src, vrid: vrid, reason: "bad MAC, auth_key may differ from the peer"}
+	}
+	// Each VRRP instance of the peer has its own counter.
+	key := fmt.Sprintf("%s/%d", src, vrid)
+	if counter <= a.lastCounters[key] {
+		return &haAuthError{src: src, vrid: vrid, reason: "replayed counter"}
+	}
+	a.lastCounters[key] = counter
+	return nil
+}
+
+func (a *haAuth) mac(msg []byte, src net.IP, counter uint64) []byte {
+	m := hmac.New(sha256.New, a.key)
+	// The source address and the VRID are covered so that an advertisement
+	// cannot be resent as one from another peer or for another instance.
+	m.Write(src.To16())
+	m.Write([]byte{msg[1]})
+	// The checksum covers the trailer, so it is excluded from the MAC.
+	m.Write(msg[:6])
+	m.Write([]byte{0, 0})
+	m.Write(msg[8:])
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	m.Write(c[:])
+	return m.Sum(nil)[:haAuthMACSize]
+}
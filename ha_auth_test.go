@@ -0,0 +1,74 @@
+package goloba
+
+import (
+	"net"
+	"testing"
+)
+
+func newTestAuthMessage(vrid, priority uint8) []byte {
+	return marshalAdvertisement(&advertisement{
+		VersionType: vrrpVersionType,
+		VRID:        vrid,
+		Priority:    priority,
+		AdvertInt:   100,
+	}, net.IPv4len)
+}
+
+func TestHAAuthVerify(t *testing.T) {
+	peer := net.ParseIP("192.0.2.2")
+	sender := newHAAuth("secret")
+	receiver := newHAAuth("secret")
+
+	msg := newTestAuthMessage(1, 100)
+	old := sender.trailer(msg, peer)
+	trailer := sender.trailer(msg, peer)
+	if err := receiver.verify(msg, trailer, peer); err != nil {
+		t.Fatalf("verify: unexpected error %v", err)
+	}
+	if err := receiver.verify(msg, trailer, peer); err == nil {
+		t.Error("verify: replayed advertisement accepted")
+	}
+	if err := receiver.verify(msg, old, peer); err == nil {
+		t.Error("verify: advertisement with lower counter accepted")
+	}
+
+	// A fresh advertisement must not be accepted as one from another peer.
+	spoofed := net.ParseIP("192.0.2.3")
+	if err := receiver.verify(msg, sender.trailer(msg, peer), spoofed); err == nil {
+		t.Error("verify: advertisement resent with another source accepted")
+	}
+	if _, ok := receiver.lastCounters["192.0.2.3/1"]; ok {
+		t.Error("verify: counter recorded for spoofed source")
+	}
+
+	modified := newTestAuthMessage(1, 255)
+	if err := receiver.verify(modified, sender.trailer(msg, peer), peer); err == nil {
+		t.Error("verify: modified advertisement accepted")
+	}
+
+	other := newHAAuth("other")
+	if err := receiver.verify(msg, other.trailer(msg, peer), peer); err == nil {
+		t.Error("verify: advertisement with another key accepted")
+	}
+	if err := receiver.verify(msg, nil, peer); err == nil {
+		t.Error("verify: advertisement without trailer accepted")
+	}
+}
+
+func TestHAAuthCounterPerInstance(t *testing.T) {
+	peer := net.ParseIP("192.0.2.2")
+	receiver := newHAAuth("secret")
+
+	// Each instance of the peer has its own haAuth and counter.
+	msg1 := newTestAuthMessage(1, 100)
+	msg2 := newTestAuthMessage(2, 100)
+	sender2 := newHAAuth("secret")
+	sender1 := newHAAuth("secret")
+	trailer2 := sender2.trailer(msg2, peer)
+	if err := receiver.verify(msg1, sender1.trailer(msg1, peer), peer); err != nil {
+		t.Fatalf("verify vrid 1: unexpected error %v", err)
+	}
+	if err := receiver.verify(msg2, trailer2, peer); err != nil {
+		t.Fatalf("verify vrid 2: unexpected error %v", err)
+	}
+}
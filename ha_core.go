@@ -1,9 +1,11 @@
 package goloba
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"sync"
 	"sync/atomic"
@@ -13,6 +15,7 @@ import (
 )
 
 // advertisement represents a VRRPv3 advertisement packet.  Field names and sizes are per RFC 5798.
+// CountIPAddrs is set from IPAddrs when the advertisement is sent.
 type advertisement struct {
 	VersionType  uint8
 	VRID         uint8
@@ -20,12 +23,16 @@ type advertisement struct {
 	CountIPAddrs uint8
 	AdvertInt    uint16
 	Checksum     uint16
+	IPAddrs      []net.IP
 }
 
 const (
-	// vrrpAdvertSize is the expected number of bytes in the Advertisement struct.
+	// vrrpAdvertSize is the number of bytes in the fixed part of the Advertisement.
 	vrrpAdvertSize = 8
 
+	// vrrpMaxIPAddrs is the maximum number of addresses in an Advertisement.
+	vrrpMaxIPAddrs = 255
+
 	// vrrpAdvertType is the type of VRRP advertisements to send and receive.
 	vrrpAdvertType = uint8(1)
 
@@ -40,40 +47,93 @@ const (
 	vrrpPort = 112
 )
 
+// haConn sends and receives VRRP advertisements.
+type haConn interface {
+	send(advert *advertisement, timeout time.Duration) error
+	// receive returns the advertisement and the source address of the
+	// packet, or nil for both if the packet is ignorable.
+	receive() (*advertisement, net.IP, error)
+}
+
+// receivedAdvertisement is an advertisement with the source address of the packet.
+type receivedAdvertisement struct {
+	advert *advertisement
+	src    net.IP
+}
+
 // haNodeConfig specifies the configuration for a Node.
 type haNodeConfig struct {
 	haConfig
+	Name                 string
 	MasterAdvertInterval time.Duration
 	Preempt              bool
+	Tracks               []VRRPTrackConfig
 }
 
 // haNode represents one member of a high availability cluster.
 type haNode struct {
 	haNodeConfig
-	conn                  *ipHAConn
+	conn                  haConn
 	engine                *haEngine
 	statusLock            sync.RWMutex
 	haStatus              haStatus
 	sendCount             uint64
 	receiveCount          uint64
+	rejectCount           uint64
 	masterDownInterval    time.Duration
+	advertInterval        time.Duration
 	lastMasterAdvertTime  time.Time
 	errChannel            chan error
-	recvChannel           chan *advertisement
+	recvChannel           chan *receivedAdvertisement
 	stopSenderChannel     chan haState
+	controlChannel        chan *haControlRequest
+	stepDown              bool
 	keepVIPsDuringRestart bool
+
+	// advertVIPs is the VIPs in advertisements, and peerVIPsMismatch is the
+	// VIPs from the peer which were logged as mismatched last time.
+	advertVIPs       []net.IP
+	peerVIPsMismatch string
+
+	// onStateChange is called on state transitions if it is not nil.
+	// It must not block.
+	onStateChange func(oldState, state haState)
+}
+
+// haControlOp is an operation to change the HA state of a node manually.
+type haControlOp int
+
+const (
+	haControlFailover haControlOp = iota
+	haControlMaintenanceOn
+	haControlMaintenanceOff
+	haControlPriority
+)
+
+type haControlRequest struct {
+	op       haControlOp
+	priority uint8
+	result   chan haState
 }
 
 // newHANode creates a new Node with the given NodeConfig and haConn.
-func newHANode(cfg haNodeConfig, conn *ipHAConn, eng *haEngine) *haNode {
+func newHANode(cfg haNodeConfig, conn haConn, eng *haEngine) *haNode {
 	n := &haNode{
 		haNodeConfig:         cfg,
 		conn:                 conn,
 		engine:               eng,
 		lastMasterAdvertTime: time.Now(),
 		errChannel:           make(chan error),
-		recvChannel:          make(chan *advertisement, 20),
+		recvChannel:          make(chan *receivedAdvertisement, 20),
 		stopSenderChannel:    make(chan haState),
+		controlChannel:       make(chan *haControlRequest),
+		advertVIPs:           advertVIPs(cfg.LocalAddr, eng.config.vips),
+	}
+	n.haStatus.Priority = cfg.Priority
+	for _, peer := range cfg.peers() {
+		if !peer.IsMulticast() {
+			n.haStatus.Peers = append(n.haStatus.Peers, haPeerStatus{Addr: peer})
+		}
 	}
 	n.setState(haBackup)
 	n.resetMasterDownInterval(cfg.MasterAdvertInterval)
@@ -82,10 +142,14 @@ func newHANode(cfg haNodeConfig, conn *ipHAConn, eng *haEngine) *haNode {
 
 // resetMasterDownInterval calculates masterDownInterval per RFC 5798.
 func (n *haNode) resetMasterDownInterval(advertInterval time.Duration) {
-	skewTime := (time.Duration((256 - int(n.Priority))) * (advertInterval)) / 256
+	n.advertInterval = advertInterval
+	skewTime := (time.Duration((256 - int(n.priority()))) * (advertInterval)) / 256
 	masterDownInterval := 3*(advertInterval) + skewTime
 	if masterDownInterval != n.masterDownInterval {
 		n.masterDownInterval = masterDownInterval
+		n.statusLock.Lock()
+		n.haStatus.MasterDownInterval = masterDownInterval
+		n.statusLock.Unlock()
 		if ltsvlog.Logger.DebugEnabled() {
 			ltsvlog.Logger.Debug().String("msg", "resetMasterDownInterval").Fmt("skewTime", "%v", skewTime).Fmt("masterDownInterval", "%v", masterDownInterval).Log()
 		}
@@ -99,15 +163,148 @@ func (n *haNode) state() haState {
 	return n.haStatus.State
 }
 
+// priority returns the current priority for this node.
+func (n *haNode) priority() uint8 {
+	n.statusLock.RLock()
+	defer n.statusLock.RUnlock()
+	return n.haStatus.Priority
+}
+
+// setPriority changes the current priority. It must be called in the run loop
+// so that the master down interval is updated consistently.
+func (n *haNode) setPriority(priority uint8) {
+	n.statusLock.Lock()
+	old := n.haStatus.Priority
+	n.haStatus.Priority = priority
+	n.statusLock.Unlock()
+	if priority != old {
+		ltsvlog.Logger.Info().String("msg", "changed VRRP priority").Uint8("vrid", n.VRID).
+			Uint8("oldPriority", old).Uint8("priority", priority).Log()
+		n.resetMasterDownInterval(n.advertInterval)
+	}
+}
+
+// status returns a copy of the HA status for this node. Silent peers are
+// expired here too since all the peers may stop sending advertisements.
+func (n *haNode) status() haStatus {
+	n.statusLock.Lock()
+	n.expirePeers(time.Now())
+	status := n.haStatus
+	status.Peers = append([]haPeerStatus(nil), n.haStatus.Peers...)
+	n.statusLock.Unlock()
+	status.Sent = atomic.LoadUint64(&n.sendCount)
+	status.Received = atomic.LoadUint64(&n.receiveCount)
+	status.Rejected = atomic.LoadUint64(&n.rejectCount)
+	return status
+}
+
+// recordAdvertisement records the advertisement received from the peer
+// in the HA status.
+func (n *haNode) recordAdvertisement(advert *advertisement, src net.IP) {
+	n.statusLock.Lock()
+	defer n.statusLock.Unlock()
+	now := time.Now()
+	n.haStatus.LastAdvert = now
+	n.haStatus.LastAdvertPriority = advert.Priority
+
+	var peer *haPeerStatus
+	for i := range n.haStatus.Peers {
+		if n.haStatus.Peers[i].Addr.Equal(src) {
+			peer = &n.haStatus.Peers[i]
+			break
+		}
+	}
+	if peer == nil {
+		n.haStatus.Peers = append(n.haStatus.Peers, haPeerStatus{Addr: src})
+		peer = &n.haStatus.Peers[len(n.haStatus.Peers)-1]
+	}
+	peer.LastAdvert = now
+	peer.LastAdvertPriority = advert.Priority
+	n.expirePeers(now)
+}
+
+// peerExpireIntervals is the number of master down intervals after which
+// a peer which is not configured is removed from the status if it has sent
+// no advertisements.
+const peerExpireIntervals = 5
+
+// expirePeers removes the peers which were learned from advertisements and
+// have been silent for peerExpireIntervals master down intervals, so that
+// the peers in multicast mode do not grow without bound. The configured
+// unicast peers are kept. The caller must hold n.statusLock.
+func (n *haNode) expirePeers(now time.Time) {
+	expire := peerExpireIntervals * n.haStatus.MasterDownInterval
+	peers := n.haStatus.Peers[:0]
+	for _, p := range n.haStatus.Peers {
+		if now.Sub(p.LastAdvert) <= expire || n.isConfiguredPeer(p.Addr) {
+			peers = append(peers, p)
+		}
+	}
+	n.haStatus.Peers = peers
+}
+
+// isConfiguredPeer reports whether addr is one of the unicast peers in
+// the config.
+func (n *haNode) isConfiguredPeer(addr net.IP) bool {
+	for _, peer := range n.peers() {
+		if !peer.IsMulticast() && peer.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// inMaintenance reports whether this node is kept in backup manually.
+func (n *haNode) inMaintenance() bool {
+	n.statusLock.RLock()
+	defer n.statusLock.RUnlock()
+	return n.haStatus.Maintenance
+}
+
+func (n *haNode) setMaintenance(maintenance bool) {
+	n.statusLock.Lock()
+	defer n.statusLock.Unlock()
+	n.haStatus.Maintenance = maintenance
+}
+
+// control requests the run loop of this node to do op, and returns the
+// state which this node has after op is done.
+//
+// haControlFailover makes the master send a priority 0 advertisement and
+// step down to backup. The API rejects it if preemption is enabled, since
+// the node would become master again at once.
+// haControlMaintenanceOn does the same as failover if this node is master,
+// and keeps this node in backup until haControlMaintenanceOff is requested.
+// The maintenance mode is not kept across restarts.
+// haControlPriority changes the current priority to priority.
+func (n *haNode) control(ctx context.Context, op haControlOp, priority uint8) (haState, error) {
+	req := &haControlRequest{op: op, priority: priority, result: make(chan haState, 1)}
+	select {
+	case n.controlChannel <- req:
+	case <-ctx.Done():
+		return haUnkown, ctx.Err()
+	}
+	select {
+	case state := <-req.result:
+		return state, nil
+	case <-ctx.Done():
+		return haUnkown, ctx.Err()
+	}
+}
+
 // setState changes the HA state for this node.
 func (n *haNode) setState(s haState) {
 	n.statusLock.Lock()
-	defer n.statusLock.Unlock()
-	if n.haStatus.State != s {
+	oldState := n.haStatus.State
+	if oldState != s {
 		n.haStatus.State = s
 		n.haStatus.Since = time.Now()
 		n.haStatus.Transitions++
 	}
+	n.statusLock.Unlock()
+	if oldState != s && n.onStateChange != nil {
+		n.onStateChange(oldState, s)
+	}
 }
 
 // newAdvertisement creates a new Advertisement with this Node's VRID and priority.
@@ -115,9 +312,72 @@ func (n *haNode) newAdvertisement() *advertisement {
 	return &advertisement{
 		VersionType: vrrpVersionType,
 		VRID:        n.VRID,
-		Priority:    n.Priority,
+		Priority:    n.priority(),
 		AdvertInt:   uint16(n.MasterAdvertInterval / time.Millisecond / 10), // AdvertInt is in centiseconds
+		IPAddrs:     n.advertVIPs,
+	}
+}
+
+// advertVIPs returns the VIPs to be put in advertisements. VRRPv3 advertises
+// the addresses of the same family as the local address only.
+func advertVIPs(localAddr net.IP, vips []*haEngineVIPConfig) []net.IP {
+	ipv4 := localAddr.To4() != nil
+	var ips []net.IP
+	for _, vip := range vips {
+		if (vip.ip.To4() != nil) != ipv4 {
+			ltsvlog.Logger.Info().String("msg", "VIP of different address family from local_address is not advertised").
+				Stringer("vip", vip.ip).Stringer("localAddress", localAddr).Log()
+			continue
+		}
+		if len(ips) == vrrpMaxIPAddrs {
+			ltsvlog.Logger.Info().String("msg", "too many VIPs to advertise").Int("max", vrrpMaxIPAddrs).Log()
+			break
+		}
+		ips = append(ips, vip.ip)
+	}
+	return ips
+}
+
+// checkPeerVIPs logs if the VIPs in the advertisement from the peer differ
+// from ours. It logs once for the same VIPs from the peer.
+func (n *haNode) checkPeerVIPs(advert *advertisement, src net.IP) {
+	if sameIPSet(advert.IPAddrs, n.advertVIPs) {
+		if n.peerVIPsMismatch != "" {
+			ltsvlog.Logger.Info().String("msg", "VIPs in VRRP advertisement match ours now").
+				Uint8("vrid", n.VRID).Stringer("src", src).Log()
+			n.peerVIPsMismatch = ""
+		}
+		return
+	}
+	peerVIPs := fmt.Sprint(advert.IPAddrs)
+	if peerVIPs == n.peerVIPsMismatch {
+		return
+	}
+	n.peerVIPsMismatch = peerVIPs
+	ltsvlog.Logger.Info().String("msg", "VIPs in VRRP advertisement differ from ours, check vips on both nodes").
+		Uint8("vrid", n.VRID).Stringer("src", src).String("peerVIPs", peerVIPs).
+		Fmt("vips", "%v", n.advertVIPs).Log()
+}
+
+// sameIPSet reports whether a and b have the same addresses regardless of
+// the order.
+func sameIPSet(a, b []net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ip := range a {
+		found := false
+		for _, ip2 := range b {
+			if ip.Equal(ip2) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
 	}
+	return true
 }
 
 // run sends and receives advertisements, changes this Node's state in response to incoming
@@ -150,6 +410,14 @@ func (n *haNode) runOnce(ctx context.Context) error {
 		case haBackup:
 			// do nothing
 		case haMaster:
+			if n.inMaintenance() {
+				// Stay in backup and restart waiting for the master down interval.
+				if ltsvlog.Logger.DebugEnabled() {
+					ltsvlog.Logger.Debug().String("msg", "staying backup since in maintenance").Log()
+				}
+				n.lastMasterAdvertTime = time.Now()
+				break
+			}
 			if ltsvlog.Logger.DebugEnabled() {
 				ltsvlog.Logger.Debug().String("msg", "received advertisements").Uint64("receiveCount", atomic.LoadUint64(&n.receiveCount)).Int("recvChannelLen", len(n.recvChannel)).Log()
 				ltsvlog.Logger.Debug().String("msg", "Last master Advertisement dequeued").String("dequeuedAt", n.lastMasterAdvertTime.Format(time.StampMilli)).Log()
@@ -189,13 +457,23 @@ func (n *haNode) becomeMaster() {
 	n.setState(haMaster)
 }
 
+// becomeBackup changes this node from master to backup. If stepping down was
+// requested, it sends a priority 0 advertisement so that the peer takes over
+// immediately.
 func (n *haNode) becomeBackup() {
-	ltsvlog.Logger.Info().String("msg", "Node.becomeBackup").Log()
+	stepDown := n.stepDown
+	n.stepDown = false
+	ltsvlog.Logger.Info().String("msg", "Node.becomeBackup").Bool("stepDown", stepDown).Log()
 	if err := n.engine.HAState(haBackup); err != nil {
 		ltsvlog.Logger.Err(ltsvlog.Err(fmt.Errorf("Failed to notify engine: %v", err)).Stack(""))
 	}
 
 	n.stopSenderChannel <- haBackup
+	if stepDown {
+		n.sendShutdownAdvertisement()
+		ltsvlog.Logger.Info().String("msg", "sent priority 0 advertisement to step down").Log()
+	}
+	n.lastMasterAdvertTime = time.Now()
 	n.setState(haBackup)
 }
 
@@ -227,26 +505,42 @@ func (n *haNode) becomeShutdown() {
 
 func (n *haNode) doMasterTasks(ctx context.Context) haState {
 	select {
-	case advert := <-n.recvChannel:
+	case recv := <-n.recvChannel:
+		advert := recv.advert
 		if advert.VersionType != vrrpVersionType {
 			// Ignore
 			return haMaster
 		}
 		if advert.VRID != n.VRID {
-			ltsvlog.Logger.Info().String("msg", "doMasterTasks: ignoring Advertisement").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
+			// Advertisements for other VRRP instances are received too.
+			if ltsvlog.Logger.DebugEnabled() {
+				ltsvlog.Logger.Debug().String("msg", "doMasterTasks: ignoring Advertisement").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
+			}
 			return haMaster
 		}
-		if advert.Priority == n.Priority {
-			// TODO(angusc): RFC 5798 says we should compare IP addresses at this point.
-			ltsvlog.Logger.Info().String("msg", "doMasterTasks: ignoring Advertisement with my priority").Uint8("peerPriority", advert.Priority).Log()
+		myPriority := n.priority()
+		if advert.Priority == myPriority {
+			// Per RFC 5798, the node with the greater primary address wins
+			// on equal priority.
+			if compareIP(recv.src, n.LocalAddr) > 0 {
+				ltsvlog.Logger.Info().String("msg", "doMasterTasks: peer address > my address with same priority - becoming BACKUP").
+					Uint8("peerPriority", advert.Priority).Stringer("peerAddr", recv.src).Stringer("myAddr", n.LocalAddr).Log()
+				n.lastMasterAdvertTime = time.Now()
+				return haBackup
+			}
+			ltsvlog.Logger.Info().String("msg", "doMasterTasks: ignoring Advertisement with my priority from smaller address").
+				Uint8("peerPriority", advert.Priority).Stringer("peerAddr", recv.src).Log()
 			return haMaster
 		}
-		if advert.Priority > n.Priority {
+		if advert.Priority > myPriority {
 			ltsvlog.Logger.Info().String("msg", "doMasterTasks: peer priority > my priority - becoming BACKUP").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
 			n.lastMasterAdvertTime = time.Now()
 			return haBackup
 		}
 
+	case req := <-n.controlChannel:
+		return n.handleControl(req, haMaster)
+
 	case <-ctx.Done():
 		if ltsvlog.Logger.DebugEnabled() {
 			ltsvlog.Logger.Debug().String("msg", "got ctx.Done(), returning haShutdown from doMasterTasks").Log()
@@ -263,13 +557,39 @@ func (n *haNode) doMasterTasks(ctx context.Context) haState {
 	return haMaster
 }
 
+// handleControl handles a control request in the run loop and returns the
+// next state.
+func (n *haNode) handleControl(req *haControlRequest, state haState) haState {
+	next := state
+	switch req.op {
+	case haControlFailover:
+		next = haBackup
+	case haControlMaintenanceOn:
+		n.setMaintenance(true)
+		next = haBackup
+	case haControlMaintenanceOff:
+		n.setMaintenance(false)
+	case haControlPriority:
+		n.setPriority(req.priority)
+	}
+	if state == haMaster && next == haBackup {
+		ltsvlog.Logger.Info().String("msg", "stepping down to BACKUP by request").Uint8("vrid", n.VRID).Log()
+		n.stepDown = true
+	}
+	req.result <- next
+	return next
+}
+
 func (n *haNode) doBackupTasks(ctx context.Context) haState {
 	deadline := n.lastMasterAdvertTime.Add(n.masterDownInterval)
 	remaining := deadline.Sub(time.Now())
 	timeout := time.After(remaining)
 	select {
-	case advert := <-n.recvChannel:
-		return n.backupHandleAdvertisement(advert)
+	case recv := <-n.recvChannel:
+		return n.backupHandleAdvertisement(recv.advert)
+
+	case req := <-n.controlChannel:
+		return n.handleControl(req, haBackup)
 
 	case <-ctx.Done():
 		if ltsvlog.Logger.DebugEnabled() {
@@ -288,11 +608,11 @@ func (n *haNode) doBackupTasks(ctx context.Context) haState {
 			ltsvlog.Logger.Debug().String("msg", "doBackupTasks: timed out waiting for Advertisement").Stringer("remaining", remaining).Log()
 		}
 		select {
-		case advert := <-n.recvChannel:
+		case recv := <-n.recvChannel:
 			if ltsvlog.Logger.DebugEnabled() {
 				ltsvlog.Logger.Debug().String("msg", "doBackupTasks: found Advertisement queued for processing")
 			}
-			return n.backupHandleAdvertisement(advert)
+			return n.backupHandleAdvertisement(recv.advert)
 		default:
 			if ltsvlog.Logger.DebugEnabled() {
 				ltsvlog.Logger.Debug().String("msg", "doBackupTasks: becoming MASTER").Log()
@@ -309,14 +629,16 @@ func (n *haNode) backupHandleAdvertisement(advert *advertisement) haState {
 		return haBackup
 
 	case advert.VRID != n.VRID:
-		ltsvlog.Logger.Info().String("msg", "backupHandleAdvertisement: ignoring Advertisement").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
+		if ltsvlog.Logger.DebugEnabled() {
+			ltsvlog.Logger.Debug().String("msg", "backupHandleAdvertisement: ignoring Advertisement").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
+		}
 		return haBackup
 
 	case advert.Priority == 0:
 		ltsvlog.Logger.Info().String("msg", "backupHandleAdvertisement: peer priority is 0 - becoming MASTER")
 		return haMaster
 
-	case n.Preempt && advert.Priority < n.Priority:
+	case n.Preempt && advert.Priority < n.priority():
 		ltsvlog.Logger.Info().String("msg", "backupHandleAdvertisement: peer priority < my priority - becoming MASTER").Uint8("peerVRID", advert.VRID).Uint8("myVRID", n.VRID).Log()
 		return haMaster
 	}
@@ -328,12 +650,12 @@ func (n *haNode) backupHandleAdvertisement(advert *advertisement) haState {
 	return haBackup
 }
 
-func (n *haNode) queueAdvertisement(advert *advertisement) {
+func (n *haNode) queueAdvertisement(recv *receivedAdvertisement) {
 	if queueLen := len(n.recvChannel); queueLen > 0 {
 		ltsvlog.Logger.Info().String("msg", "queueAdvertisement: advertisements already queued").Int("queueLen", queueLen).Log()
 	}
 	select {
-	case n.recvChannel <- advert:
+	case n.recvChannel <- recv:
 	default:
 		n.errChannel <- ltsvlog.Err(errors.New("queueAdvertisement: recvChannel is full")).Stack("")
 	}
@@ -355,13 +677,7 @@ func (n *haNode) sendAdvertisements() {
 					n.doSendMasterAdvertisement()
 					ltsvlog.Logger.Info().String("msg", "sent last master advertisement before graceful restart").Log()
 				} else {
-					advert := n.newAdvertisement()
-					advert.Priority = 0
-					if err := n.conn.send(advert, time.Second); err != nil {
-						ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
-							return fmt.Errorf("sendAdvertisements: Failed to send shutdown Advertisement, %v", err)
-						}).Stack(""))
-					}
+					n.sendShutdownAdvertisement()
 					ltsvlog.Logger.Info().String("msg", "sent shutdown advertisement").Log()
 				}
 			}
@@ -370,6 +686,18 @@ func (n *haNode) sendAdvertisements() {
 	}
 }
 
+// sendShutdownAdvertisement sends an advertisement with priority 0 so that
+// the backup becomes master without waiting for the master down interval.
+func (n *haNode) sendShutdownAdvertisement() {
+	advert := n.newAdvertisement()
+	advert.Priority = 0
+	if err := n.conn.send(advert, time.Second); err != nil {
+		ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("sendAdvertisements: Failed to send shutdown Advertisement, %v", err)
+		}).Stack(""))
+	}
+}
+
 func (n *haNode) doSendMasterAdvertisement() {
 	if err := n.conn.send(n.newAdvertisement(), n.MasterAdvertInterval); err != nil {
 		select {
@@ -390,7 +718,15 @@ func (n *haNode) doSendMasterAdvertisement() {
 
 func (n *haNode) receiveAdvertisements() {
 	for {
-		if advert, err := n.conn.receive(); err != nil {
+		if advert, src, err := n.conn.receive(); err != nil {
+			if authErr, ok := err.(*haAuthError); ok {
+				if authErr.vrid == n.VRID {
+					atomic.AddUint64(&n.rejectCount, 1)
+					ltsvlog.Logger.Info().String("msg", "rejected VRRP advertisement, check auth_key is the same on all nodes").
+						Uint8("vrid", n.VRID).Fmt("src", "%v", authErr.src).String("reason", authErr.reason).Log()
+				}
+				continue
+			}
 			select {
 			case n.errChannel <- err:
 			default:
@@ -399,12 +735,16 @@ func (n *haNode) receiveAdvertisements() {
 				}).Stack(""))
 				os.Exit(1)
 			}
-		} else if advert != nil {
+		} else if advert != nil && advert.VRID == n.VRID {
+			// The connection receives advertisements of all the VRRP
+			// instances, so ones for other VRIDs are dropped here.
 			receiveCount := atomic.AddUint64(&n.receiveCount, 1)
 			if ltsvlog.Logger.DebugEnabled() {
 				ltsvlog.Logger.Debug().String("msg", "receiveAdvertisements: Received advertisements").Uint64("receveCount", receiveCount).Log()
 			}
-			n.queueAdvertisement(advert)
+			n.recordAdvertisement(advert, src)
+			n.checkPeerVIPs(advert, src)
+			n.queueAdvertisement(&receivedAdvertisement{advert: advert, src: src})
 		}
 	}
 }
@@ -416,3 +756,12 @@ func (n *haNode) SetKeepVIPsDuringRestart(keep bool) {
 		ltsvlog.Logger.Debug().String("msg", "SetKeepVIPsDuringRestart").Bool("keep", keep).Log()
 	}
 }
+
+// compareIP compares IP addresses as unsigned integers in network byte order
+// as RFC 5798 says. IPv4 addresses are compared in the 4 byte form.
+func compareIP(a, b net.IP) int {
+	if a4, b4 := a.To4(), b.To4(); a4 != nil && b4 != nil {
+		return bytes.Compare(a4, b4)
+	}
+	return bytes.Compare(a.To16(), b.To16())
+}
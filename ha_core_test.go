@@ -0,0 +1,361 @@
+package goloba
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+func TestMain(m *testing.M) {
+	ltsvlog.Logger = ltsvlog.NewLTSVLogger(testLog, false)
+	os.Exit(m.Run())
+}
+
+// testLog has the logs written in tests. Tests checking the logs reset it
+// first.
+var testLog = &testLogWriter{}
+
+type testLogWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *testLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *testLogWriter) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset()
+}
+
+func (w *testLogWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+type fakeHAPacket struct {
+	advert *advertisement
+	src    net.IP
+}
+
+// fakeHAConn is a haConn which receives the packets queued to recvC and
+// records the sent advertisements to sentC.
+type fakeHAConn struct {
+	recvC chan fakeHAPacket
+	sentC chan *advertisement
+}
+
+func newFakeHAConn() *fakeHAConn {
+	return &fakeHAConn{
+		recvC: make(chan fakeHAPacket, 10),
+		sentC: make(chan *advertisement, 100),
+	}
+}
+
+func (c *fakeHAConn) send(advert *advertisement, timeout time.Duration) error {
+	select {
+	case c.sentC <- advert:
+	default:
+	}
+	return nil
+}
+
+func (c *fakeHAConn) receive() (*advertisement, net.IP, error) {
+	p := <-c.recvC
+	return p.advert, p.src, nil
+}
+
+func (c *fakeHAConn) receiveFrom(src string, priority uint8, vips ...net.IP) {
+	c.recvC <- fakeHAPacket{
+		advert: &advertisement{
+			VersionType:  vrrpVersionType,
+			VRID:         1,
+			Priority:     priority,
+			CountIPAddrs: uint8(len(vips)),
+			AdvertInt:    100,
+			IPAddrs:      vips,
+		},
+		src: net.ParseIP(src).To4(),
+	}
+}
+
+// newTestHANode returns a node and the function to stop its sender if it is
+// master at the end of the test.
+func newTestHANode(conn haConn, advertInterval time.Duration) (*haNode, func()) {
+	cfg := haNodeConfig{
+		haConfig: haConfig{
+			Enabled:    true,
+			LocalAddr:  net.ParseIP("192.0.2.2").To4(),
+			RemoteAddr: net.ParseIP("224.0.0.18").To4(),
+			Priority:   100,
+			VRID:       1,
+		},
+		MasterAdvertInterval: advertInterval,
+		Preempt:              true,
+	}
+	n := newHANode(cfg, conn, &haEngine{config: &haEngineConfig{}})
+	go n.receiveAdvertisements()
+	return n, func() {
+		if n.state() == haMaster {
+			n.stopSenderChannel <- haBackup
+		}
+	}
+}
+
+// runTestHANode runs the node until ctx is done, and returns a channel
+// closed when it stops.
+func runTestHANode(ctx context.Context, n *haNode) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n.state() != haShutdown {
+			if err := n.runOnce(ctx); err != nil {
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// waitFor waits until cond returns true, or fails the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHANodeEqualPriorityTieBreak(t *testing.T) {
+	testCases := []struct {
+		peer string
+		want haState
+	}{
+		{peer: "192.0.2.3", want: haBackup},
+		{peer: "192.0.2.1", want: haMaster},
+	}
+	for _, tc := range testCases {
+		conn := newFakeHAConn()
+		n, cleanup := newTestHANode(conn, time.Second)
+		defer cleanup()
+		n.becomeMaster()
+
+		conn.receiveFrom(tc.peer, 100)
+		if err := n.runOnce(context.Background()); err != nil {
+			t.Fatalf("runOnce: %v", err)
+		}
+		if got := n.state(); got != tc.want {
+			t.Errorf("state after advertisement with same priority from %s: got=%v, want=%v", tc.peer, got, tc.want)
+		}
+	}
+}
+
+func TestHANodePriorityZeroTakeover(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, time.Second)
+	defer cleanup()
+
+	conn.receiveFrom("192.0.2.3", 200)
+	if err := n.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	if got := n.state(); got != haBackup {
+		t.Fatalf("state after advertisement with higher priority: got=%v, want=%v", got, haBackup)
+	}
+
+	start := time.Now()
+	conn.receiveFrom("192.0.2.3", 0)
+	if err := n.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	if got := n.state(); got != haMaster {
+		t.Fatalf("state after priority 0 advertisement: got=%v, want=%v", got, haMaster)
+	}
+	if elapsed := time.Since(start); elapsed >= n.masterDownInterval {
+		t.Errorf("took over after %s, want before master down interval %s", elapsed, n.masterDownInterval)
+	}
+}
+
+func TestHANodeMasterDown(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, 10*time.Millisecond)
+	defer cleanup()
+
+	start := time.Now()
+	if err := n.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	if got := n.state(); got != haMaster {
+		t.Fatalf("state after master down interval: got=%v, want=%v", got, haMaster)
+	}
+	if elapsed := time.Since(start); elapsed < n.masterDownInterval {
+		t.Errorf("became master after %s, want after master down interval %s", elapsed, n.masterDownInterval)
+	}
+
+	select {
+	case advert := <-conn.sentC:
+		if advert.Priority != 100 || advert.VRID != 1 {
+			t.Errorf("sent advertisement: got priority=%d vrid=%d, want priority=100 vrid=1", advert.Priority, advert.VRID)
+		}
+	case <-time.After(time.Second):
+		t.Error("no advertisement sent as master")
+	}
+}
+
+func TestHANodePeerVIPsMismatch(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, time.Second)
+	defer cleanup()
+	vip1 := net.ParseIP("192.0.2.100").To4()
+	vip2 := net.ParseIP("192.0.2.101").To4()
+	// It is read by the receiving goroutine after the packets are queued.
+	n.advertVIPs = []net.IP{vip1, vip2}
+	n.becomeMaster()
+	testLog.reset()
+
+	for i := 0; i < 2; i++ {
+		conn.receiveFrom("192.0.2.3", 50, vip1)
+		if err := n.runOnce(context.Background()); err != nil {
+			t.Fatalf("runOnce: %v", err)
+		}
+	}
+	if got := n.state(); got != haMaster {
+		t.Errorf("state after advertisements with other VIPs: got=%v, want=%v", got, haMaster)
+	}
+	if got := strings.Count(testLog.String(), "VIPs in VRRP advertisement differ from ours"); got != 1 {
+		t.Errorf("logs of VIPs mismatch: got=%d, want=1", got)
+	}
+
+	conn.receiveFrom("192.0.2.3", 50, vip2, vip1)
+	if err := n.runOnce(context.Background()); err != nil {
+		t.Fatalf("runOnce: %v", err)
+	}
+	if got := n.state(); got != haMaster {
+		t.Errorf("state after advertisement with same VIPs: got=%v, want=%v", got, haMaster)
+	}
+	if !strings.Contains(testLog.String(), "VIPs in VRRP advertisement match ours now") {
+		t.Error("no log of VIPs matching again")
+	}
+}
+
+func TestHANodeExpirePeers(t *testing.T) {
+	n := newHANode(haNodeConfig{
+		haConfig: haConfig{
+			LocalAddr:    net.ParseIP("192.0.2.2").To4(),
+			UnicastPeers: []net.IP{net.ParseIP("192.0.2.3").To4()},
+			Priority:     100,
+			VRID:         1,
+		},
+		MasterAdvertInterval: time.Second,
+	}, newFakeHAConn(), &haEngine{config: &haEngineConfig{}})
+
+	advert := &advertisement{VersionType: vrrpVersionType, VRID: 1, Priority: 100}
+	n.recordAdvertisement(advert, net.ParseIP("192.0.2.3").To4())
+	n.recordAdvertisement(advert, net.ParseIP("192.0.2.4").To4())
+	n.recordAdvertisement(advert, net.ParseIP("192.0.2.5").To4())
+	if got := len(n.status().Peers); got != 3 {
+		t.Fatalf("peers: got=%d, want=3", got)
+	}
+
+	// Make the peers except 192.0.2.5 silent for longer than the expiry.
+	n.statusLock.Lock()
+	silent := time.Now().Add(-peerExpireIntervals*n.haStatus.MasterDownInterval - time.Second)
+	for i := range n.haStatus.Peers {
+		if !n.haStatus.Peers[i].Addr.Equal(net.ParseIP("192.0.2.5")) {
+			n.haStatus.Peers[i].LastAdvert = silent
+		}
+	}
+	n.statusLock.Unlock()
+
+	// The configured peer is kept even if it is silent.
+	peers := n.status().Peers
+	var got []string
+	for _, p := range peers {
+		got = append(got, p.Addr.String())
+	}
+	if len(got) != 2 || got[0] != "192.0.2.3" || got[1] != "192.0.2.5" {
+		t.Errorf("peers after expiry: got=%v, want=[192.0.2.3 192.0.2.5]", got)
+	}
+}
+
+func TestHANodeFailover(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, 10*time.Millisecond)
+	defer cleanup()
+	n.Preempt = false
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runTestHANode(ctx, n)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitFor(t, "master", func() bool { return n.state() == haMaster })
+
+	state, err := n.control(ctx, haControlFailover, 0)
+	if err != nil {
+		t.Fatalf("control: %v", err)
+	}
+	if state != haBackup {
+		t.Errorf("state after failover: got=%v, want=%v", state, haBackup)
+	}
+	waitFor(t, "priority 0 advertisement", func() bool {
+		select {
+		case advert := <-conn.sentC:
+			return advert.Priority == 0
+		default:
+			return false
+		}
+	})
+}
+
+func TestHANodeMaintenance(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, 10*time.Millisecond)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := runTestHANode(ctx, n)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitFor(t, "master", func() bool { return n.state() == haMaster })
+
+	state, err := n.control(ctx, haControlMaintenanceOn, 0)
+	if err != nil {
+		t.Fatalf("control: %v", err)
+	}
+	if state != haBackup || !n.status().Maintenance {
+		t.Fatalf("after maintenance on: got state=%v maintenance=%v, want backup in maintenance", state, n.status().Maintenance)
+	}
+
+	// The node never becomes master in maintenance even though no
+	// advertisements are received for many master down intervals.
+	time.Sleep(10 * n.masterDownInterval)
+	if got := n.state(); got != haBackup {
+		t.Fatalf("state in maintenance: got=%v, want=%v", got, haBackup)
+	}
+
+	if _, err := n.control(ctx, haControlMaintenanceOff, 0); err != nil {
+		t.Fatalf("control: %v", err)
+	}
+	if n.status().Maintenance {
+		t.Error("maintenance after maintenance off: got=true, want=false")
+	}
+	waitFor(t, "master after maintenance", func() bool { return n.state() == haMaster })
+}
@@ -26,6 +26,15 @@ type haEngineVIPConfig struct {
 	cancel context.CancelFunc
 }
 
+// parseVIP parses a VIP in the CIDR notation, for example "192.0.2.1/32".
+func parseVIP(s string) (*haEngineVIPConfig, error) {
+	ip, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("VIP %q is not in the CIDR notation", s)
+	}
+	return &haEngineVIPConfig{ip: ip, ipNet: ipNet}, nil
+}
+
 // haEngine implements the Engine interface for testing purposes.
 type haEngine struct {
 	config                *haEngineConfig
@@ -82,7 +91,7 @@ func (e *haEngine) updateHAStateForVIP(state haState, vipCfg *haEngineVIPConfig)
 				String("interface", c.vipInterface.Name).Stringer("vip", vipCfg.ip).
 				Stringer("mask", vipCfg.ipNet.Mask).Log()
 		} else {
-			err := netutil.AddAddr(c.vipInterface, vipCfg.ip, vipCfg.ipNet, "")
+			err := addVIPAddr(c.vipInterface, vipCfg)
 			if err != nil {
 				return ltsvlog.WrapErr(err, func(err error) error {
 					return fmt.Errorf("failed to add IP address, err=%v", err)
@@ -142,14 +151,14 @@ func (e *haEngine) sendGARPLoop(ctx context.Context, intf *net.Interface, vip ne
 	for {
 		select {
 		case <-ticker.C:
-			err := netutil.SendGARP(intf, vip)
+			err := announceVIP(intf, vip)
 			if err != nil {
 				ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
-					return fmt.Errorf("failed to send GARP, err=%v", err)
+					return fmt.Errorf("failed to send GARP or NA, err=%v", err)
 				}).Stringer("vip", vip).Stack(""))
 			}
 			if ltsvlog.Logger.DebugEnabled() {
-				ltsvlog.Logger.Debug().String("msg", "sent GARP").Stringer("vip", vip).Log()
+				ltsvlog.Logger.Debug().String("msg", "sent GARP or NA").Stringer("vip", vip).Log()
 			}
 		case <-ctx.Done():
 			if ltsvlog.Logger.DebugEnabled() {
@@ -164,6 +173,24 @@ func (e *haEngine) SetKeepVIPsDuringRestart(keep bool) {
 	e.keepVIPsDuringRestart = keep
 }
 
+// heldVIPs returns the VIPs which the VIP interface has.
+func (e *haEngine) heldVIPs() ([]*haEngineVIPConfig, error) {
+	c := e.config
+	var vips []*haEngineVIPConfig
+	for _, vipCfg := range c.vips {
+		hasVIP, err := netutil.HasAddr(c.vipInterface, vipCfg.ip)
+		if err != nil {
+			return nil, ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to check wether we have VIP; %v", err)
+			}).String("interface", c.vipInterface.Name).Stringer("vip", vipCfg.ip).Stack("")
+		}
+		if hasVIP {
+			vips = append(vips, vipCfg)
+		}
+	}
+	return vips, nil
+}
+
 func (e *haEngine) hasAnyVIP() (bool, error) {
 	c := e.config
 	for _, vipCfg := range c.vips {
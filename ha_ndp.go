@@ -0,0 +1,189 @@
+package goloba
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/hnakamur/ltsvlog"
+	"github.com/hnakamur/netutil"
+)
+
+const (
+	// icmpv6NeighborAdvertisement is the ICMPv6 type of Neighbor Advertisement.
+	icmpv6NeighborAdvertisement = 136
+
+	// ndpOptTargetLinkLayerAddr is the NDP option type of Target Link-Layer Address.
+	ndpOptTargetLinkLayerAddr = 2
+
+	// ndpNAFlagOverride is the Override flag in the first byte of the
+	// Neighbor Advertisement flags.
+	ndpNAFlagOverride = 0x20
+)
+
+var ipv6AllNodes = net.ParseIP("ff02::1")
+
+// announceVIP sends a GARP for an IPv4 VIP, or an unsolicited Neighbor
+// Advertisement for an IPv6 VIP, so that neighbors update their caches.
+func announceVIP(intf *net.Interface, vip net.IP) error {
+	if vip.To4() != nil {
+		return netutil.SendGARP(intf, vip)
+	}
+	return sendUnsolicitedNA(intf, vip)
+}
+
+// sendUnsolicitedNA sends an unsolicited Neighbor Advertisement for the IPv6
+// address to the all-nodes multicast address per RFC 4861 section 7.2.6.
+func sendUnsolicitedNA(intf *net.Interface, ip net.IP) error {
+	c, err := net.ListenIP("ip6:ipv6-icmp", &net.IPAddr{IP: ip})
+	if err != nil {
+		return ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to listen ICMPv6, err=%v", err)
+		}).Stringer("ip", ip).Stack("")
+	}
+	defer c.Close()
+
+	f, err := c.File()
+	if err != nil {
+		return ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("fail to get file from connection, err=%v", err)
+		}).Stringer("ip", ip).Stack("")
+	}
+	defer f.Close()
+
+	// HOPLIMIT = 255 per RFC 4861
+	if err := setsockopt(f, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_HOPS, 255); err != nil {
+		return err
+	}
+	if err := setsockopt(f, syscall.IPPROTO_IPV6, syscall.IPV6_MULTICAST_IF, intf.Index); err != nil {
+		return err
+	}
+
+	// The kernel recalculates the ICMPv6 checksum anyway.
+	msg := buildUnsolicitedNA(intf.HardwareAddr, ip)
+	if _, err := c.WriteToIP(msg, &net.IPAddr{IP: ipv6AllNodes, Zone: intf.Name}); err != nil {
+		return ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to send Neighbor Advertisement, err=%v", err)
+		}).Stringer("ip", ip).String("interface", intf.Name).Stack("")
+	}
+	return nil
+}
+
+// buildUnsolicitedNA builds an ICMPv6 Neighbor Advertisement message with
+// the Override flag and the Target Link-Layer Address option, which tells
+// that target is at hwAddr. The checksum is for the packet from target to
+// the all-nodes multicast address.
+func buildUnsolicitedNA(hwAddr net.HardwareAddr, target net.IP) []byte {
+	// The option length is in units of 8 octets.
+	optLen := (2 + len(hwAddr) + 7) / 8
+	b := make([]byte, 24+optLen*8)
+	b[0] = icmpv6NeighborAdvertisement
+	b[4] = ndpNAFlagOverride
+	copy(b[8:24], target.To16())
+	b[24] = ndpOptTargetLinkLayerAddr
+	b[25] = uint8(optLen)
+	copy(b[26:], hwAddr)
+	binary.BigEndian.PutUint16(b[2:4], icmpv6Checksum(b, target, ipv6AllNodes))
+	return b
+}
+
+// icmpv6Checksum calculates the ICMPv6 checksum of msg over the IPv6
+// pseudo-header per RFC 4443 section 2.3. The checksum field of msg must
+// be zero.
+func icmpv6Checksum(msg []byte, src, dst net.IP) uint16 {
+	b := make([]byte, 40, 40+len(msg))
+	copy(b[0:16], src.To16())
+	copy(b[16:32], dst.To16())
+	binary.BigEndian.PutUint32(b[32:36], uint32(len(msg)))
+	b[39] = syscall.IPPROTO_ICMPV6
+	return ipChecksum(append(b, msg...))
+}
+
+// addVIPAddr adds the VIP to the interface. An IPv6 VIP is added without the
+// duplicate address detection, so that it can be used and announced
+// immediately on failover.
+func addVIPAddr(intf *net.Interface, vipCfg *haEngineVIPConfig) error {
+	if vipCfg.ip.To4() != nil {
+		return netutil.AddAddr(intf, vipCfg.ip, vipCfg.ipNet, "")
+	}
+	return addIPv6AddrNoDAD(intf, vipCfg.ip, vipCfg.ipNet)
+}
+
+func addIPv6AddrNoDAD(intf *net.Interface, ip net.IP, ipNet *net.IPNet) error {
+	prefixLen, _ := ipNet.Mask.Size()
+	attrLen := syscall.SizeofRtAttr + net.IPv6len
+	req := make([]byte, syscall.SizeofNlMsghdr+syscall.SizeofIfAddrmsg+2*attrLen)
+	*(*syscall.NlMsghdr)(unsafe.Pointer(&req[0])) = syscall.NlMsghdr{
+		Len:   uint32(len(req)),
+		Type:  syscall.RTM_NEWADDR,
+		Flags: syscall.NLM_F_REQUEST | syscall.NLM_F_CREATE | syscall.NLM_F_EXCL | syscall.NLM_F_ACK,
+		Seq:   1,
+	}
+	*(*syscall.IfAddrmsg)(unsafe.Pointer(&req[syscall.SizeofNlMsghdr])) = syscall.IfAddrmsg{
+		Family:    syscall.AF_INET6,
+		Prefixlen: uint8(prefixLen),
+		Flags:     syscall.IFA_F_NODAD,
+		Index:     uint32(intf.Index),
+	}
+	off := syscall.SizeofNlMsghdr + syscall.SizeofIfAddrmsg
+	for _, typ := range []uint16{syscall.IFA_LOCAL, syscall.IFA_ADDRESS} {
+		*(*syscall.RtAttr)(unsafe.Pointer(&req[off])) = syscall.RtAttr{Len: uint16(attrLen), Type: typ}
+		copy(req[off+syscall.SizeofRtAttr:], ip.To16())
+		off += attrLen
+	}
+	return netlinkRequest(req)
+}
+
+// netlinkRequest sends the route netlink request and waits for the ack.
+func netlinkRequest(req []byte) error {
+	s, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(s)
+	lsa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}
+	if err := syscall.Bind(s, lsa); err != nil {
+		return err
+	}
+	if err := syscall.Sendto(s, req, 0, lsa); err != nil {
+		return err
+	}
+
+	rb := make([]byte, syscall.Getpagesize())
+	for {
+		nr, _, err := syscall.Recvfrom(s, rb, 0)
+		if err != nil {
+			return err
+		}
+		if nr < syscall.NLMSG_HDRLEN {
+			return syscall.EINVAL
+		}
+		msgs, err := syscall.ParseNetlinkMessage(rb[:nr])
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			switch msg.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				return netlinkError(&msg)
+			}
+		}
+	}
+}
+
+// netlinkError returns the error in the NLMSG_ERROR message, or nil if it
+// is an acknowledgement.
+func netlinkError(msg *syscall.NetlinkMessage) error {
+	// The message starts with the error code in int32.
+	if len(msg.Data) < 4 {
+		return syscall.EINVAL
+	}
+	if errCode := *(*int32)(unsafe.Pointer(&msg.Data[0])); errCode != 0 {
+		return syscall.Errno(-errCode)
+	}
+	return nil
+}
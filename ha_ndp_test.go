@@ -0,0 +1,85 @@
+package goloba
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestBuildUnsolicitedNA(t *testing.T) {
+	hwAddr := net.HardwareAddr{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}
+	target := net.ParseIP("2001:db8::10")
+	b := buildUnsolicitedNA(hwAddr, target)
+
+	if len(b) != 32 {
+		t.Fatalf("length: got=%d, want=32", len(b))
+	}
+	if b[0] != 136 || b[1] != 0 {
+		t.Errorf("type and code: got=%d/%d, want=136/0", b[0], b[1])
+	}
+	flags := b[4]
+	if flags&0x20 == 0 {
+		t.Errorf("Override flag not set, flags=%#x", flags)
+	}
+	if flags&(0x80|0x40) != 0 {
+		t.Errorf("Router or Solicited flag set, flags=%#x", flags)
+	}
+	if got := net.IP(b[8:24]); !got.Equal(target) {
+		t.Errorf("target address: got=%s, want=%s", got, target)
+	}
+
+	// Target Link-Layer Address option, whose length is in units of 8 octets.
+	opt := b[24:]
+	if opt[0] != 2 || opt[1] != 1 {
+		t.Errorf("option type and length: got=%d/%d, want=2/1", opt[0], opt[1])
+	}
+	if got := net.HardwareAddr(opt[2:8]); !bytes.Equal(got, hwAddr) {
+		t.Errorf("target link-layer address: got=%s, want=%s", got, hwAddr)
+	}
+
+	// The one's complement sum over the pseudo-header and the message
+	// including the checksum is 0xffff for a valid checksum.
+	var pseudo [40]byte
+	copy(pseudo[0:16], target.To16())
+	copy(pseudo[16:32], net.ParseIP("ff02::1").To16())
+	binary.BigEndian.PutUint32(pseudo[32:36], uint32(len(b)))
+	pseudo[39] = 58 // ICMPv6
+	var sum uint32
+	data := append(pseudo[:], b...)
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	if sum != 0xffff {
+		t.Errorf("checksum %#04x is invalid, sum=%#04x", binary.BigEndian.Uint16(b[2:4]), sum)
+	}
+}
+
+func TestNetlinkError(t *testing.T) {
+	// The error code is in the native byte order.
+	errMsg := func(code int32) []byte {
+		b := make([]byte, 4)
+		*(*int32)(unsafe.Pointer(&b[0])) = code
+		return b
+	}
+	testCases := []struct {
+		data []byte
+		want error
+	}{
+		{data: errMsg(0), want: nil},
+		{data: errMsg(-int32(syscall.EEXIST)), want: syscall.EEXIST},
+		{data: []byte{0, 0}, want: syscall.EINVAL},
+		{data: nil, want: syscall.EINVAL},
+	}
+	for _, tc := range testCases {
+		msg := &syscall.NetlinkMessage{Data: tc.data}
+		if got := netlinkError(msg); got != tc.want {
+			t.Errorf("%v: got=%v, want=%v", tc.data, got, tc.want)
+		}
+	}
+}
@@ -110,16 +110,28 @@ func setsockopt(f *os.File, level, opt, value int) error {
 	return nil
 }
 
-// ipHAConn is a high availability connection.
+// ipHAConn is a high availability connection. For multicast, raddrs has only
+// the group address. For unicast, raddrs has the peers, and packets from the
+// other addresses are dropped.
 type ipHAConn struct {
-	sendConn *net.IPConn
-	recvConn *net.IPConn
-	laddr    net.IP
-	raddr    net.IP
+	sendConn  *net.IPConn
+	recvConn  *net.IPConn
+	laddr     net.IP
+	raddrs    []net.IP
+	multicast bool
+	auth      *haAuth
+
+	// recvBuffer and oobBuffer are per connection since each VRRP instance
+	// receives packets in its own goroutine.
+	recvBuffer []byte
+	oobBuffer  []byte
 }
 
-// newIPHAConn creates a new ipHAConn.
-func newIPHAConn(laddr, raddr net.IP) (*ipHAConn, error) {
+// newIPHAConn creates a new ipHAConn. raddrs must be a multicast group address
+// or unicast peer addresses. If authKey is not empty, advertisements are
+// authenticated with it.
+func newIPHAConn(laddr net.IP, raddrs []net.IP, authKey string) (*ipHAConn, error) {
+	raddr := raddrs[0]
 	sendConn, err := ipConn(laddr, raddr)
 	if err != nil {
 		return nil, err
@@ -147,10 +159,14 @@ func newIPHAConn(laddr, raddr net.IP) (*ipHAConn, error) {
 	}
 
 	return &ipHAConn{
-		sendConn: sendConn,
-		recvConn: recvConn,
-		laddr:    laddr,
-		raddr:    raddr,
+		sendConn:   sendConn,
+		recvConn:   recvConn,
+		laddr:      laddr,
+		raddrs:     raddrs,
+		multicast:  raddr.IsMulticast(),
+		auth:       newHAAuth(authKey),
+		recvBuffer: make([]byte, recvBufferSize),
+		oobBuffer:  make([]byte, oobBufferSize),
 	}, nil
 }
 
@@ -235,10 +251,68 @@ func (c *ipHAConn) af() int {
 	return syscall.AF_INET6
 }
 
+// addrLen returns the length of addresses in advertisements.
+func (c *ipHAConn) addrLen() int {
+	if c.laddr.To4() != nil {
+		return net.IPv4len
+	}
+	return net.IPv6len
+}
+
+// marshalAdvertisement encodes the advertisement with the addresses of
+// addrLen bytes.
+func marshalAdvertisement(advert *advertisement, addrLen int) []byte {
+	b := make([]byte, vrrpAdvertSize, vrrpAdvertSize+len(advert.IPAddrs)*addrLen)
+	b[0] = advert.VersionType
+	b[1] = advert.VRID
+	b[2] = advert.Priority
+	b[3] = uint8(len(advert.IPAddrs))
+	binary.BigEndian.PutUint16(b[4:6], advert.AdvertInt)
+	binary.BigEndian.PutUint16(b[6:8], advert.Checksum)
+	for _, ip := range advert.IPAddrs {
+		if addrLen == net.IPv4len {
+			ip = ip.To4()
+		} else {
+			ip = ip.To16()
+		}
+		b = append(b, ip...)
+	}
+	return b
+}
+
+// unmarshalAdvertisement decodes the advertisement with the addresses of
+// addrLen bytes at the beginning of b. It also returns the length of the
+// advertisement.
+func unmarshalAdvertisement(b []byte, addrLen int) (*advertisement, int, error) {
+	if len(b) < vrrpAdvertSize {
+		return nil, 0, fmt.Errorf("advertisement too short, length=%d", len(b))
+	}
+	advert := &advertisement{
+		VersionType:  b[0],
+		VRID:         b[1],
+		Priority:     b[2],
+		CountIPAddrs: b[3],
+		AdvertInt:    binary.BigEndian.Uint16(b[4:6]),
+		Checksum:     binary.BigEndian.Uint16(b[6:8]),
+	}
+	n := vrrpAdvertSize + int(advert.CountIPAddrs)*addrLen
+	if len(b) < n {
+		return nil, 0, fmt.Errorf("advertisement too short for %d addresses, length=%d", advert.CountIPAddrs, len(b))
+	}
+	for off := vrrpAdvertSize; off < n; off += addrLen {
+		ip := make(net.IP, addrLen)
+		copy(ip, b[off:off+addrLen])
+		advert.IPAddrs = append(advert.IPAddrs, ip)
+	}
+	return advert, n, nil
+}
+
 // receive reads an IP packet from the IP layer and translates it into an advertisement.
+// It also returns the source address of the packet.
 // receive blocks until either an advertisement is received or an error occurs.  If the
-// error is a recoverable/ignorable error, receive will return (nil, nil).
-func (c *ipHAConn) receive() (*advertisement, error) {
+// error is a recoverable/ignorable error, receive will return (nil, nil, nil).
+// If the advertisement is rejected by the authentication, the error is *haAuthError.
+func (c *ipHAConn) receive() (*advertisement, net.IP, error) {
 	p, err := c.readPacket()
 	if err != nil {
 		switch err := err.(type) {
@@ -250,47 +324,74 @@ func (c *ipHAConn) receive() (*advertisement, error) {
 					if ltsvlog.Logger.DebugEnabled() {
 						ltsvlog.Logger.Debug().String("msg", "IPHAConn.receive: Ignoring ENOPROTOOPT/EPROTO").Log()
 					}
-					return nil, nil
+					return nil, nil, nil
 				}
 			}
 		}
-		return nil, err
-	} else if len(p.payload) != vrrpAdvertSize {
+		return nil, nil, err
+	}
+	return c.parsePacket(p)
+}
+
+// parsePacket translates a received packet into an advertisement. It
+// returns nil for both the advertisement and the error if the packet is
+// dropped.
+func (c *ipHAConn) parsePacket(p *packet) (*advertisement, net.IP, error) {
+	if len(p.payload) < vrrpAdvertSize {
 		// Ignore
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	advert := &advertisement{}
-	reader := bytes.NewReader(p.payload)
-	if err := binary.Read(reader, binary.BigEndian, advert); err != nil {
-		return nil, err
+	advert, msgLen, err := unmarshalAdvertisement(p.payload, c.addrLen())
+	if err != nil {
+		ltsvlog.Logger.Info().String("msg", "IPHAConn.receive: Invalid VRRP advertisement").String("err", err.Error()).Fmt("src", "%v", p.src).Log()
+		return nil, nil, nil
 	}
 
 	// Drop packets from ourselves.
 	if p.src.Equal(c.laddr) {
 		ltsvlog.Logger.Info().String("msg", "IPHAConn.receive: Received packet from localhost").Fmt("src", "%v", p.src).Log()
-		return nil, nil
+		return nil, nil, nil
+	}
+
+	// Drop packets from unknown peers for unicast.
+	if !c.multicast && !c.isPeer(p.src) {
+		if ltsvlog.Logger.DebugEnabled() {
+			ltsvlog.Logger.Debug().String("msg", "IPHAConn.receive: Received packet from unknown peer").Fmt("src", "%v", p.src).Log()
+		}
+		return nil, nil, nil
 	}
 
 	// Drop packets that don't have a TTL/HOPLIMIT.
 	if p.ttl != 255 {
 		ltsvlog.Logger.Info().String("msg", "IPHAConn.receive: Invalid TTL/HOPLIMIT").Uint8("ttl", p.ttl).Fmt("src", "%v", p.src).Log()
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// Validate the VRRP checksum.
-	chksum, err := checksum(advert, p.src, p.dst)
+	chksum, err := checksum(p.payload, p.src, p.dst)
 	if err != nil {
 		ltsvlog.Logger.Info().String("msg", "IPHAConn.receive: Failed to compute checksum from").Fmt("src", "%v", p.src).Log()
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	if chksum != 0 {
 		ltsvlog.Logger.Info().String("msg", "IPHAConn.receive: Invalid VRRP checksum").Fmt("checksum", "%x", advert.Checksum).Fmt("src", "%v", p.src).Log()
-		return nil, nil
+		return nil, nil, nil
 	}
 
-	return advert, nil
+	if c.auth != nil {
+		if err := c.auth.verify(p.payload[:msgLen], p.payload[msgLen:], p.src); err != nil {
+			return nil, nil, err
+		}
+	} else if len(p.payload) == msgLen+haAuthTrailerSize {
+		return nil, nil, &haAuthError{src: p.src, vrid: advert.VRID, reason: "authentication data found, auth_key may be configured only on the peer"}
+	} else if len(p.payload) != msgLen {
+		// Ignore
+		return nil, nil, nil
+	}
+
+	return advert, p.src, nil
 }
 
 // packet encapsulates information about a received IP packet.
@@ -301,13 +402,13 @@ type packet struct {
 	payload []byte
 }
 
-var (
-	// Up to 60 bytes for the IPv4 header + 8 bytes for the VRRP payload, rounded
-	// to the next power of 2.
-	recvBuffer = make([]byte, 96)
+const (
+	// Up to 60 bytes for the IPv4 header + the VRRP payload, which may have
+	// the authentication trailer.
+	recvBufferSize = 60 + vrrpAdvertSize + vrrpMaxIPAddrs*net.IPv6len + haAuthTrailerSize
 
 	// Per RFC 3542 10240 bytes should "always be large enough".
-	oobBuffer = make([]byte, 10240)
+	oobBufferSize = 10240
 )
 
 // readPacket reads a packet from this IPHAConn's recvConn.
@@ -325,7 +426,7 @@ func (c *ipHAConn) readPacket() (*packet, error) {
 // header, so the TTL, source and destination addresses directly are read
 // directly from the header.
 func (c *ipHAConn) readIPv4Packet() (*packet, error) {
-	b := recvBuffer
+	b := c.recvBuffer
 	n, err := c.recvConn.Read(b)
 	if err != nil {
 		return nil, err
@@ -352,8 +453,8 @@ func (c *ipHAConn) readIPv4Packet() (*packet, error) {
 // the control message data (see RFCs 3542 and 2292). The source address is
 // taken from the ReadMsgIP return values.
 func (c *ipHAConn) readIPv6Packet() (*packet, error) {
-	b := recvBuffer
-	oob := oobBuffer
+	b := c.recvBuffer
+	oob := c.oobBuffer
 	n, oobn, _, raddr, err := c.recvConn.ReadMsgIP(b, oob)
 	if err != nil {
 		return nil, err
@@ -405,33 +506,48 @@ func (c *ipHAConn) send(advert *advertisement, timeout time.Duration) error {
 		return err
 	}
 
-	if advert.Checksum == 0 {
-		chksum, err := checksum(advert, c.laddr, c.raddr)
+	a := *advert
+	a.Checksum = 0
+	b := marshalAdvertisement(&a, c.addrLen())
+	if c.auth != nil {
+		b = append(b, c.auth.trailer(b, c.laddr)...)
+	}
+
+	// The checksum differs for each peer since it covers the destination
+	// address. A failure for a peer does not prevent sending to the others.
+	var firstErr error
+	for _, raddr := range c.raddrs {
+		binary.BigEndian.PutUint16(b[6:8], 0)
+		chksum, err := checksum(b, c.laddr, raddr)
 		if err != nil {
 			return fmt.Errorf("IPHAConn.send: checksum failed: %v", err)
 		}
-		advert.Checksum = chksum
-	}
+		binary.BigEndian.PutUint16(b[6:8], chksum)
 
-	buf := new(bytes.Buffer)
-	if err := binary.Write(buf, binary.BigEndian, advert); err != nil {
-		return err
+		if _, err := c.sendConn.WriteToIP(b, &net.IPAddr{IP: raddr}); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
+	return firstErr
+}
 
-	if _, err := c.sendConn.WriteToIP(buf.Bytes(), &net.IPAddr{IP: c.raddr}); err != nil {
-		return err
+func (c *ipHAConn) isPeer(ip net.IP) bool {
+	for _, raddr := range c.raddrs {
+		if raddr.Equal(ip) {
+			return true
+		}
 	}
-
-	return nil
+	return false
 }
 
-func checksum(advert *advertisement, srcIP, dstIP net.IP) (uint16, error) {
+// checksum calculates the checksum of the VRRP message in payload.
+func checksum(payload []byte, srcIP, dstIP net.IP) (uint16, error) {
 	buf := new(bytes.Buffer)
 	if src, dst := srcIP.To4(), dstIP.To4(); src != nil && dst != nil {
 		// IPv4
 		hdr := &ipv4PseudoHeader{
 			Protocol: vrrpPort,
-			VRRPLen:  vrrpAdvertSize,
+			VRRPLen:  uint16(len(payload)),
 		}
 		copy(hdr.Src[:], src)
 		copy(hdr.Dst[:], dst)
@@ -442,7 +558,7 @@ func checksum(advert *advertisement, srcIP, dstIP net.IP) (uint16, error) {
 	} else if src, dst := srcIP.To16(), dstIP.To16(); src != nil && dst != nil {
 		// IPv6
 		hdr := &ipv6PseudoHeader{
-			VRRPLen:    vrrpAdvertSize,
+			VRRPLen:    uint32(len(payload)),
 			NextHeader: vrrpPort,
 		}
 		copy(hdr.Src[:], src)
@@ -455,9 +571,7 @@ func checksum(advert *advertisement, srcIP, dstIP net.IP) (uint16, error) {
 		return 0, fmt.Errorf("ha.checksum(%q, %q): Need two IPv4 or IPv6 addresses", srcIP, dstIP)
 	}
 
-	if err := binary.Write(buf, binary.BigEndian, advert); err != nil {
-		return 0, err
-	}
+	buf.Write(payload)
 	return ipChecksum(buf.Bytes()), nil
 }
 
@@ -0,0 +1,122 @@
+package goloba
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestMarshalAdvertisement(t *testing.T) {
+	testCases := []struct {
+		addrLen int
+		vips    []string
+	}{
+		{addrLen: net.IPv4len, vips: nil},
+		{addrLen: net.IPv4len, vips: []string{"192.0.2.100", "192.0.2.101"}},
+		{addrLen: net.IPv6len, vips: []string{"2001:db8::100", "2001:db8::101", "2001:db8::102"}},
+	}
+	for _, tc := range testCases {
+		var ips []net.IP
+		for _, vip := range tc.vips {
+			ips = append(ips, net.ParseIP(vip))
+		}
+		advert := &advertisement{
+			VersionType: vrrpVersionType,
+			VRID:        10,
+			Priority:    150,
+			AdvertInt:   100,
+			Checksum:    0x1234,
+			IPAddrs:     ips,
+		}
+		b := marshalAdvertisement(advert, tc.addrLen)
+		if want := vrrpAdvertSize + len(ips)*tc.addrLen; len(b) != want {
+			t.Errorf("%v: length unmatch, got=%d, want=%d", tc.vips, len(b), want)
+		}
+
+		// The authentication trailer after the message is not decoded.
+		got, n, err := unmarshalAdvertisement(append(b, make([]byte, haAuthTrailerSize)...), tc.addrLen)
+		if err != nil {
+			t.Errorf("%v: unmarshalAdvertisement: unexpected error %v", tc.vips, err)
+			continue
+		}
+		if n != len(b) {
+			t.Errorf("%v: message length unmatch, got=%d, want=%d", tc.vips, n, len(b))
+		}
+		if got.VersionType != advert.VersionType || got.VRID != advert.VRID || got.Priority != advert.Priority ||
+			got.AdvertInt != advert.AdvertInt || got.Checksum != advert.Checksum || int(got.CountIPAddrs) != len(ips) {
+			t.Errorf("%v: advertisement unmatch, got=%+v, want=%+v", tc.vips, got, advert)
+		}
+		if len(got.IPAddrs) != len(ips) {
+			t.Errorf("%v: addresses unmatch, got=%v", tc.vips, got.IPAddrs)
+			continue
+		}
+		for i, ip := range got.IPAddrs {
+			if len(ip) != tc.addrLen || !ip.Equal(ips[i]) {
+				t.Errorf("%v: address %d unmatch, got=%v", tc.vips, i, ip)
+			}
+		}
+
+		if _, _, err := unmarshalAdvertisement(b[:len(b)-1], tc.addrLen); err == nil && len(ips) > 0 {
+			t.Errorf("%v: unmarshalAdvertisement: truncated advertisement accepted", tc.vips)
+		}
+	}
+	if _, _, err := unmarshalAdvertisement(make([]byte, vrrpAdvertSize-1), net.IPv4len); err == nil {
+		t.Error("unmarshalAdvertisement: too short advertisement accepted")
+	}
+}
+
+// newTestPacket returns a packet with the advertisement from src to dst.
+func newTestPacket(t *testing.T, src, dst string, priority uint8) *packet {
+	srcIP, dstIP := net.ParseIP(src).To4(), net.ParseIP(dst).To4()
+	b := marshalAdvertisement(&advertisement{
+		VersionType: vrrpVersionType,
+		VRID:        1,
+		Priority:    priority,
+		AdvertInt:   100,
+	}, net.IPv4len)
+	chksum, err := checksum(b, srcIP, dstIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(b[6:8], chksum)
+	return &packet{src: srcIP, dst: dstIP, ttl: 255, payload: b}
+}
+
+func TestIPHAConnParsePacketUnicastPeers(t *testing.T) {
+	c := &ipHAConn{
+		laddr:  net.ParseIP("192.0.2.2").To4(),
+		raddrs: []net.IP{net.ParseIP("192.0.2.3").To4(), net.ParseIP("192.0.2.4").To4()},
+	}
+	testCases := []struct {
+		src    string
+		accept bool
+	}{
+		{src: "192.0.2.3", accept: true},
+		{src: "192.0.2.4", accept: true},
+		{src: "192.0.2.5", accept: false},
+		{src: "192.0.2.2", accept: false},
+	}
+	for _, tc := range testCases {
+		advert, src, err := c.parsePacket(newTestPacket(t, tc.src, "192.0.2.2", 100))
+		if err != nil {
+			t.Errorf("%s: parsePacket: unexpected error %v", tc.src, err)
+			continue
+		}
+		if got := advert != nil; got != tc.accept {
+			t.Errorf("%s: accepted unmatch, got=%v, want=%v", tc.src, got, tc.accept)
+		}
+		if tc.accept && (src == nil || !src.Equal(net.ParseIP(tc.src))) {
+			t.Errorf("%s: source unmatch, got=%v", tc.src, src)
+		}
+	}
+
+	// Any source is accepted for multicast.
+	c = &ipHAConn{
+		laddr:     net.ParseIP("192.0.2.2").To4(),
+		raddrs:    []net.IP{net.ParseIP("224.0.0.18").To4()},
+		multicast: true,
+	}
+	if advert, _, _ := c.parsePacket(newTestPacket(t, "192.0.2.5", "224.0.0.18", 100)); advert == nil {
+		t.Error("multicast: advertisement dropped")
+	}
+}
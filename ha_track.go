@@ -0,0 +1,152 @@
+package goloba
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+// defaultVRRPTrackInterval is the default interval to check VRRP track rules.
+const defaultVRRPTrackInterval = 2 * time.Second
+
+// runVRRPTracker checks the track rules of the node periodically, and
+// lowers the priority of the node by the weights of the failed rules.
+func (l *LoadBalancer) runVRRPTracker(ctx context.Context, node *haNode) {
+	l.mu.RLock()
+	interval := l.config.VRRP.TrackInterval
+	l.mu.RUnlock()
+	if interval <= 0 {
+		interval = defaultVRRPTrackInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastFailed := make([]bool, len(node.Tracks))
+	for {
+		priority := int(node.Priority)
+		for i := range node.Tracks {
+			t := &node.Tracks[i]
+			err := l.checkVRRPTrack(ctx, t, interval)
+			failed := err != nil
+			if failed != lastFailed[i] {
+				if failed {
+					ltsvlog.Logger.Info().String("msg", "VRRP track failed").Uint8("vrid", node.VRID).
+						String("track", t.String()).Uint8("weight", t.Weight).Fmt("err", "%v", err).Log()
+				} else {
+					ltsvlog.Logger.Info().String("msg", "VRRP track recovered").Uint8("vrid", node.VRID).
+						String("track", t.String()).Log()
+				}
+				lastFailed[i] = failed
+			}
+			if failed {
+				priority -= int(t.Weight)
+			}
+		}
+		// Priority 0 is reserved for the master to give up.
+		if priority < 1 {
+			priority = 1
+		}
+		if uint8(priority) != node.priority() {
+			_, err := node.control(ctx, haControlPriority, uint8(priority))
+			if err != nil && ctx.Err() == nil {
+				ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to change VRRP priority, err=%v", err)
+				}).Uint8("vrid", node.VRID).Int("priority", priority).Stack(""))
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkVRRPTrack returns an error if the tracked object is failed.
+func (l *LoadBalancer) checkVRRPTrack(ctx context.Context, t *VRRPTrackConfig, interval time.Duration) error {
+	switch {
+	case t.Interface != "":
+		return checkInterfaceUp(t.Interface)
+	case t.Service != "":
+		return l.checkServiceHealthy(t.Service, t.MinHealthy)
+	default:
+		timeout := t.Timeout
+		if timeout <= 0 {
+			timeout = interval
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		out, err := exec.CommandContext(ctx, "/bin/sh", "-c", t.Script).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%v, output=%q", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+}
+
+// checkInterfaceUp returns an error if the interface is administratively
+// down or its operational state is down.
+func checkInterfaceUp(name string) error {
+	intf, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	if intf.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %s is down", name)
+	}
+	state, err := ioutil.ReadFile("/sys/class/net/" + name + "/operstate")
+	if err == nil && strings.TrimSpace(string(state)) == "down" {
+		return fmt.Errorf("operational state of interface %s is down", name)
+	}
+	return nil
+}
+
+// checkServiceHealthy returns an error if the number of the destinations of
+// the service which receive traffic is less than minHealthy.
+func (l *LoadBalancer) checkServiceHealthy(name string, minHealthy int) error {
+	if minHealthy <= 0 {
+		minHealthy = 1
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	serviceConf := l.config.findServiceByName(name)
+	if serviceConf == nil {
+		return fmt.Errorf("service %s not found", name)
+	}
+	healthy := 0
+	for i := range serviceConf.Destinations {
+		if serviceConf.Destinations[i].receivesTraffic() {
+			healthy++
+		}
+	}
+	if healthy < minHealthy {
+		return fmt.Errorf("only %d healthy destinations of service %s, want %d", healthy, name, minHealthy)
+	}
+	return nil
+}
+
+// receivesTraffic returns whether new connections are sent to the
+// destination, that is, its effective weight is not zero. Destinations which
+// are detached, draining, removed or locked at weight zero do not receive
+// traffic.
+func (c *DestinationConfig) receivesTraffic() bool {
+	return !c.Detached && !c.draining && !c.removed && c.Weight > 0
+}
+
+func (t *VRRPTrackConfig) String() string {
+	switch {
+	case t.Interface != "":
+		return "interface:" + t.Interface
+	case t.Service != "":
+		return "service:" + t.Service
+	default:
+		return "script:" + t.Script
+	}
+}
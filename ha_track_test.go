@@ -0,0 +1,68 @@
+package goloba
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/netutil"
+)
+
+func TestVRRPTrackService(t *testing.T) {
+	conn := newFakeHAConn()
+	n, cleanup := newTestHANode(conn, 10*time.Millisecond)
+	defer cleanup()
+	n.Tracks = []VRRPTrackConfig{{Service: "web", Weight: 60}}
+
+	l := &LoadBalancer{
+		config: &Config{
+			VRRP: VRRPConfig{TrackInterval: 10 * time.Millisecond},
+			Services: []ServiceConfig{{
+				Name:    "web",
+				Address: netutil.IP(net.ParseIP("192.0.2.1")),
+				Port:    80,
+				Destinations: []DestinationConfig{
+					{Address: netutil.IP(net.ParseIP("192.0.2.11")), Port: 80, Weight: 1},
+				},
+			}},
+		},
+	}
+	dest := &l.config.Services[0].Destinations[0]
+	setDetached := func(detached bool) {
+		l.mu.Lock()
+		dest.Detached = detached
+		l.mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := runTestHANode(ctx, n)
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go l.runVRRPTracker(ctx, n)
+
+	waitFor(t, "master", func() bool { return n.state() == haMaster })
+	if got := n.priority(); got != 100 {
+		t.Fatalf("priority with healthy service: got=%d, want=100", got)
+	}
+
+	// The failed track lowers the priority, and the peer with a higher
+	// priority than the lowered one takes over.
+	setDetached(true)
+	waitFor(t, "lowered priority", func() bool { return n.priority() == 40 })
+	if got := n.status().Priority; got != 40 {
+		t.Errorf("priority in status: got=%d, want=40", got)
+	}
+	conn.receiveFrom("192.0.2.3", 90)
+	waitFor(t, "backup", func() bool { return n.state() == haBackup })
+
+	// The recovered track restores the priority, and the node preempts the
+	// peer.
+	setDetached(false)
+	waitFor(t, "restored priority", func() bool { return n.priority() == 100 })
+	conn.receiveFrom("192.0.2.3", 90)
+	waitFor(t, "master again", func() bool { return n.state() == haMaster })
+}
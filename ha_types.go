@@ -2,6 +2,7 @@ package goloba
 
 import (
 	"net"
+	"strings"
 	"time"
 )
 
@@ -44,16 +45,47 @@ type haStatus struct {
 	Received       uint64
 	ReceivedQueued uint64
 	Transitions    uint64
+
+	// Rejected is the number of advertisements rejected by the
+	// authentication.
+	Rejected uint64
+
+	// LastAdvert and LastAdvertPriority are about the last advertisement
+	// received from the peer.
+	LastAdvert         time.Time
+	LastAdvertPriority uint8
+	MasterDownInterval time.Duration
+
+	// Maintenance is true while the node is kept in backup manually.
+	Maintenance bool
+
+	// Priority is the current priority, which is lowered from the
+	// configured one by failed track rules.
+	Priority uint8
+
+	// Peers is the status of each peer. It has the configured peers for
+	// unicast, and the peers which have sent advertisements recently for
+	// multicast.
+	Peers []haPeerStatus
+}
+
+// haPeerStatus is the status about advertisements from a peer.
+type haPeerStatus struct {
+	Addr               net.IP
+	LastAdvert         time.Time
+	LastAdvertPriority uint8
 }
 
 // haConfig represents the high availability configuration for a node in a
-// VRRP cluster.
+// VRRP cluster. UnicastPeers is set instead of RemoteAddr for unicast
+// with multiple peers.
 type haConfig struct {
-	Enabled    bool
-	LocalAddr  net.IP
-	RemoteAddr net.IP
-	Priority   uint8
-	VRID       uint8
+	Enabled      bool
+	LocalAddr    net.IP
+	RemoteAddr   net.IP
+	UnicastPeers []net.IP
+	Priority     uint8
+	VRID         uint8
 }
 
 // Equal reports whether this HAConfig is equal to the given haConfig.
@@ -61,6 +93,26 @@ func (h *haConfig) Equal(other *haConfig) bool {
 	return h.Enabled == other.Enabled &&
 		h.LocalAddr.Equal(other.LocalAddr) &&
 		h.RemoteAddr.Equal(other.RemoteAddr) &&
+		sameIPSet(h.UnicastPeers, other.UnicastPeers) &&
 		h.Priority == other.Priority &&
 		h.VRID == other.VRID
 }
+
+// peers returns the addresses to send advertisements to, which are
+// UnicastPeers if set, or RemoteAddr.
+func (h *haConfig) peers() []net.IP {
+	if len(h.UnicastPeers) > 0 {
+		return h.UnicastPeers
+	}
+	return []net.IP{h.RemoteAddr}
+}
+
+// peerString returns the peer addresses separated by commas.
+func (h *haConfig) peerString() string {
+	peers := h.peers()
+	s := make([]string, len(peers))
+	for i, peer := range peers {
+		s[i] = peer.String()
+	}
+	return strings.Join(s, ",")
+}
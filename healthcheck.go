@@ -2,12 +2,7 @@ package goloba
 
 import (
 	"context"
-	"crypto/tls"
-	"errors"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
+	"reflect"
 	"sync"
 	"time"
 
@@ -15,15 +10,8 @@ import (
 )
 
 type healthcheckerConfig struct {
-	DestinationKey  string
-	Method          string
-	URL             string
-	HostHeader      string
-	EnableKeepAlive bool
-	SkipVerifyCert  bool
-	IsOK            func(*http.Response) (bool, error)
-	Timeout         time.Duration
-	Interval        time.Duration
+	DestinationKey string
+	Checker        CheckerConfig
 }
 
 type healthcheckResult struct {
@@ -38,8 +26,22 @@ type healthcheckers struct {
 }
 
 type healthchecker struct {
-	config *healthcheckerConfig
-	client *http.Client
+	config  *healthcheckerConfig
+	checker Checker
+	cancel  context.CancelFunc
+
+	statsMu sync.Mutex
+	stats   healthcheckStats
+}
+
+// healthcheckStats is the counters of the results and the durations of
+// health checks of a destination since its health checker was started.
+type healthcheckStats struct {
+	Success      uint64
+	Failure      uint64
+	Error        uint64
+	LastDuration time.Duration
+	DurationSum  time.Duration
 }
 
 func newHealthcheckers() *healthcheckers {
@@ -51,47 +53,109 @@ func newHealthcheckers() *healthcheckers {
 func (c *healthcheckers) startHealthchecker(ctx context.Context, config *healthcheckerConfig, resultC chan<- healthcheckResult) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.doStartHealthchecker(ctx, config, resultC)
+}
+
+func (c *healthcheckers) stopHealthchecker(destKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.doStopHealthchecker(destKey)
+}
+
+// stats returns the copies of the stats of the running health checkers
+// keyed by the destination key.
+func (c *healthcheckers) stats() map[string]healthcheckStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]healthcheckStats, len(c.checkers))
+	for key, checker := range c.checkers {
+		checker.statsMu.Lock()
+		stats[key] = checker.stats
+		checker.statsMu.Unlock()
+	}
+	return stats
+}
+
+// syncHealthcheckers makes the running health checkers match desired, which
+// is keyed by the destination key. Checkers for destinations which are not in
+// desired are stopped, and checkers whose config was changed are restarted.
+// Checkers whose config is unchanged keep running.
+func (c *healthcheckers) syncHealthcheckers(ctx context.Context, desired map[string]*healthcheckerConfig, resultC chan<- healthcheckResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, checker := range c.checkers {
+		config, ok := desired[key]
+		if !ok {
+			c.doStopHealthchecker(key)
+		} else if !reflect.DeepEqual(config, checker.config) {
+			ltsvlog.Logger.Info().String("msg", "restarting healthchecker since config changed").String("destKey", key).Log()
+			c.doStopHealthchecker(key)
+		}
+	}
+	for _, config := range desired {
+		c.doStartHealthchecker(ctx, config, resultC)
+	}
+}
 
+func (c *healthcheckers) doStartHealthchecker(ctx context.Context, config *healthcheckerConfig, resultC chan<- healthcheckResult) {
 	key := config.DestinationKey
 	_, ok := c.checkers[key]
 	if ok {
 		return
 	}
 
-	checker := newHealthchecker(config)
+	checker, err := newHealthchecker(config)
+	if err != nil {
+		ltsvlog.Logger.Err(ltsvlog.WrapErr(err, nil).String("destKey", key))
+		return
+	}
+	ctx, checker.cancel = context.WithCancel(ctx)
 	c.checkers[key] = checker
 	go checker.run(ctx, resultC)
 }
 
-func newHealthchecker(config *healthcheckerConfig) *healthchecker {
-	return &healthchecker{config: config}
+func (c *healthcheckers) doStopHealthchecker(destKey string) {
+	checker, ok := c.checkers[destKey]
+	if !ok {
+		return
+	}
+	checker.cancel()
+	delete(c.checkers, destKey)
+	if ltsvlog.Logger.DebugEnabled() {
+		ltsvlog.Logger.Debug().String("msg", "stopped healthchecker").String("destKey", destKey).Log()
+	}
+}
+
+func newHealthchecker(config *healthcheckerConfig) (*healthchecker, error) {
+	checker, err := newChecker(&config.Checker)
+	if err != nil {
+		return nil, err
+	}
+	return &healthchecker{config: config, checker: checker}, nil
 }
 
 func (c *healthchecker) run(ctx context.Context, resultC chan<- healthcheckResult) {
 	if ltsvlog.Logger.DebugEnabled() {
 		ltsvlog.Logger.Debug().String("msg", "Checker.Run").Fmt("config", "%+v", c.config).Log()
 	}
-	c.client = &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return errors.New("no redirect allowed for healthcheck")
-		},
-		Timeout: c.config.Timeout,
-		Transport: &http.Transport{
-			DisableKeepAlives: !c.config.EnableKeepAlive,
-			TLSClientConfig:   &tls.Config{InsecureSkipVerify: c.config.SkipVerifyCert},
-		},
-	}
 
-	ticker := time.NewTicker(c.config.Interval)
+	ticker := time.NewTicker(c.config.Checker.HealthCheck.Interval)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-ticker.C:
-			ok, err := c.check()
-			resultC <- healthcheckResult{
+			start := time.Now()
+			ok, err := c.check(ctx)
+			c.recordStats(ok, err, time.Since(start))
+			select {
+			case resultC <- healthcheckResult{
 				DestinationKey: c.config.DestinationKey,
 				OK:             ok,
 				Err:            err,
+			}:
+			case <-ctx.Done():
+				return
 			}
 		case <-ctx.Done():
 			return
@@ -99,38 +163,29 @@ func (c *healthchecker) run(ctx context.Context, resultC chan<- healthcheckResul
 	}
 }
 
-func (c *healthchecker) check() (bool, error) {
+func (c *healthchecker) check(ctx context.Context) (bool, error) {
 	if ltsvlog.Logger.DebugEnabled() {
 		ltsvlog.Logger.Debug().String("msg", "Checker.check").Fmt("config", "%+v", c.config).Log()
 	}
-	req, err := http.NewRequest(c.config.Method, c.config.URL, nil)
-	if err != nil {
-		return false, ltsvlog.WrapErr(err, func(err error) error {
-			return fmt.Errorf("failed to create request, err=%v", err)
-		}).String("method", c.config.Method).String("url", c.config.URL).Stack("")
-	}
-	if c.config.HostHeader != "" {
-		req.Host = c.config.HostHeader
-	}
-
-	resp, err := c.client.Do(req)
-	if err != nil {
-		return false, ltsvlog.WrapErr(err, func(err error) error {
-			return fmt.Errorf("failed to send request, err=%v", err)
-		}).String("method", c.config.Method).String("url", c.config.URL).Stack("")
+	if timeout := c.config.Checker.HealthCheck.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
-	defer resp.Body.Close()
+	return c.checker.Check(ctx)
+}
 
-	ok, err := c.config.IsOK(resp)
-	if err != nil {
-		err = ltsvlog.WrapErr(err, nil).
-			String("method", c.config.Method).String("url", c.config.URL)
-	}
-	_, err2 := io.Copy(ioutil.Discard, resp.Body)
-	if err == nil && err2 != nil {
-		err = ltsvlog.WrapErr(err2, func(err error) error {
-			return fmt.Errorf("failed to read response body, err=%v", err)
-		}).String("method", c.config.Method).String("url", c.config.URL).Stack("")
+func (c *healthchecker) recordStats(ok bool, err error, elapsed time.Duration) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	switch {
+	case err != nil:
+		c.stats.Error++
+	case ok:
+		c.stats.Success++
+	default:
+		c.stats.Failure++
 	}
-	return ok, err
+	c.stats.LastDuration = elapsed
+	c.stats.DurationSum += elapsed
 }
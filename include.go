@@ -0,0 +1,65 @@
+package goloba
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+// includedConfig is the config in a file included by Config.Include.
+type includedConfig struct {
+	Defaults DefaultsConfig  `yaml:"defaults"`
+	Services []ServiceConfig `yaml:"services"`
+}
+
+// loadIncludes loads the files included by c.Include, and appends their
+// services to c.Services. The defaults in an included file are applied to
+// the services in the file, and they take precedence over c.Defaults.
+func (c *Config) loadIncludes(dir string) error {
+	for _, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("invalid include pattern %s, err=%v", pattern, err)
+			}).String("pattern", pattern).Stack("")
+		}
+		// A pattern without a wildcard is a file which must exist.
+		if len(files) == 0 && !strings.ContainsAny(pattern, `*?[\`) {
+			return ltsvlog.Err(fmt.Errorf("included config file %s not found", pattern)).String("configFile", pattern).Stack("")
+		}
+		for _, file := range files {
+			buf, err := ioutil.ReadFile(file)
+			if err != nil {
+				return ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to read included config file %s, err=%v", file, err)
+				}).String("configFile", file).Stack("")
+			}
+			var ic includedConfig
+			err = yaml.UnmarshalStrict(buf, &ic)
+			if err != nil {
+				return ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to parse included config file %s, err=%v", file, err)
+				}).String("configFile", file).Stack("")
+			}
+			ic.Defaults.HealthCheck.location = configLocation{file: file, path: "defaults.health_check"}
+			ic.Defaults.merge(&c.Defaults)
+			for i := range ic.Services {
+				s := &ic.Services[i]
+				s.source = file
+				s.sourceIndex = i
+				s.HealthCheckDefaults.location = configLocation{file: file, path: fmt.Sprintf("services[%d].health_check_defaults", i)}
+				s.applyDefaults(&ic.Defaults)
+			}
+			c.Services = append(c.Services, ic.Services...)
+		}
+	}
+	return nil
+}
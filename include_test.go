@@ -0,0 +1,179 @@
+package goloba
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestConfigFiles writes files to a temporary directory and returns
+// the directory and a function to remove it.
+func writeTestConfigFiles(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "goloba-include-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadConfigInclude(t *testing.T) {
+	dir, cleanup := writeTestConfigFiles(t, map[string]string{
+		"goloba.yml": `
+include:
+- conf.d/*.yml
+defaults:
+  schedule: rr
+  health_check:
+    url: http://192.0.2.1/
+services:
+- name: main
+  address: 192.0.2.1
+  port: 80
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+`,
+		"conf.d/a.yml": `
+defaults:
+  type: dr
+services:
+- name: a
+  address: 192.0.2.2
+  port: 80
+  destinations:
+  - address: 192.0.2.21
+    port: 80
+`,
+		"conf.d/b.yml": `
+services:
+- name: b
+  address: 192.0.2.3
+  port: 80
+  destinations:
+  - address: 192.0.2.31
+    port: 80
+`,
+		"conf.d/ignored.yaml": `invalid`,
+	})
+	defer cleanup()
+
+	c, err := LoadConfig(filepath.Join(dir, "goloba.yml"))
+	if err != nil {
+		t.Fatalf("LoadConfig: unexpected error %v", err)
+	}
+	want := []struct {
+		name     string
+		schedule string
+		typ      string
+	}{
+		{name: "main", schedule: "rr", typ: "nat"},
+		{name: "a", schedule: "rr", typ: "dr"},
+		{name: "b", schedule: "rr", typ: "nat"},
+	}
+	if len(c.Services) != len(want) {
+		t.Fatalf("service count unmatch, got=%d, want=%d", len(c.Services), len(want))
+	}
+	for i, w := range want {
+		s := &c.Services[i]
+		if s.Name != w.name || s.Schedule != w.schedule || s.Type != w.typ {
+			t.Errorf("services[%d] unmatch, got=%s %s %s, want=%s %s %s", i, s.Name, s.Schedule, s.Type, w.name, w.schedule, w.typ)
+		}
+		if url := s.Destinations[0].HealthCheck.URL; url != "http://192.0.2.1/" {
+			t.Errorf("services[%d] health check url unmatch, got=%s", i, url)
+		}
+	}
+}
+
+func TestLoadConfigIncludeError(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "missing",
+			files: map[string]string{
+				"goloba.yml": "include:\n- missing.yml\n",
+			},
+			want: []string{"included config file", "missing.yml not found"},
+		},
+		{
+			name: "malformed",
+			files: map[string]string{
+				"goloba.yml": "include:\n- conf.d/*.yml\n",
+				"conf.d/bad.yml": `
+services:
+- name: bad
+  no_such_field: 1
+`,
+			},
+			want: []string{"failed to parse included config file", "bad.yml"},
+		},
+		{
+			name: "duplicateName",
+			files: map[string]string{
+				"goloba.yml": "include:\n- conf.d/*.yml\n",
+				"conf.d/a.yml": `
+services:
+- name: web
+  address: 192.0.2.1
+  port: 80
+`,
+				"conf.d/b.yml": `
+services:
+- name: api
+  address: 192.0.2.2
+  port: 80
+- name: web
+  address: 192.0.2.3
+  port: 80
+`,
+			},
+			want: []string{`b.yml: services[1].name: duplicate service name "web" with services[0] in `, "a.yml"},
+		},
+		{
+			name: "duplicateNameInFile",
+			files: map[string]string{
+				"goloba.yml": "include:\n- conf.d/*.yml\n",
+				"conf.d/a.yml": `
+services:
+- name: web
+  address: 192.0.2.1
+  port: 80
+- name: web
+  address: 192.0.2.2
+  port: 80
+`,
+			},
+			want: []string{`a.yml: services[1].name: duplicate service name "web" with services[0]` + "\n"},
+		},
+	}
+	for _, tc := range testCases {
+		dir, cleanup := writeTestConfigFiles(t, tc.files)
+		_, err := LoadConfig(filepath.Join(dir, "goloba.yml"))
+		cleanup()
+		if err == nil {
+			t.Errorf("%s: LoadConfig: no error", tc.name)
+			continue
+		}
+		msg := err.Error() + "\n"
+		for _, w := range tc.want {
+			if !strings.Contains(msg, w) {
+				t.Errorf("%s: error %q does not contain %q", tc.name, msg, w)
+			}
+		}
+	}
+}
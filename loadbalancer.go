@@ -7,12 +7,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
-	"net/http"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"sync"
 	"syscall"
 	"time"
+	"unsafe"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -29,12 +30,18 @@ const MaxWeight = 65535
 type LoadBalancer struct {
 	ipvs             libipvs.IPVSHandle
 	mu               sync.RWMutex
-	vrrpNode         *haNode
+	vrrpNodes        []*haNode
 	servicesAndDests *ipvsServicesAndDests
 	checkers         *healthcheckers
 	checkResultC     chan healthcheckResult
+	reloadC          chan *reloadRequest
 	apiServer        *apiServer
 	config           *Config
+
+	// notifierMu guards notifier, which is replaced when the hooks are
+	// changed by reloading.
+	notifierMu sync.Mutex
+	notifier   *notifier
 }
 
 // Config is the configuration object for the load balancer.
@@ -45,7 +52,15 @@ type Config struct {
 	API            APIConfig       `yaml:"api"`
 	VRRP           VRRPConfig      `yaml:"vrrp"`
 	Services       []ServiceConfig `yaml:"services"`
+	Notify         []NotifyConfig  `yaml:"notify"`
+	Defaults       DefaultsConfig  `yaml:"defaults"`
+
+	// Include is the glob patterns of the files which have services and
+	// defaults. A relative pattern is relative to the directory of the
+	// config file.
+	Include []string `yaml:"include"`
 
+	file         string                        `yaml:"-"`
 	destinations map[string]*DestinationConfig `yaml:"-"`
 }
 
@@ -56,6 +71,8 @@ type APIConfig struct {
 }
 
 // VRRPConfig is the configuration about VRRP.
+// If Instances is empty, the other fields configure the single instance.
+// Otherwise they are the defaults for the fields which are not set in Instances.
 type VRRPConfig struct {
 	Enabled              bool          `yaml:"enabled"`
 	VRID                 uint8         `yaml:"vrid"`
@@ -67,16 +84,150 @@ type VRRPConfig struct {
 	SendGARPInterval     time.Duration `yaml:"send_garp_interval"`
 	VIPInterface         string        `yaml:"vip_interface"`
 	VIPs                 []string      `yaml:"vips"`
+
+	// UnicastPeers is the addresses of the peers to send advertisements to
+	// by unicast. If it is set, RemoteAddress is not used, and advertisements
+	// from the other addresses are dropped.
+	UnicastPeers []string `yaml:"unicast_peers"`
+
+	// AuthKey is the shared secret to authenticate advertisements with HMAC.
+	// It must be the same on all nodes, and it is disabled if empty.
+	AuthKey string `yaml:"auth_key"`
+
+	// Track is the rules to lower the priority, and TrackInterval is the
+	// interval to check them, which defaults to 2s.
+	Track         []VRRPTrackConfig `yaml:"track"`
+	TrackInterval time.Duration     `yaml:"track_interval"`
+
+	Instances []VRRPInstanceConfig `yaml:"instances"`
+}
+
+// VRRPTrackConfig is a rule to lower the VRRP priority by Weight while the
+// tracked object is failed. Exactly one of Interface, Service and Script must
+// be set.
+type VRRPTrackConfig struct {
+	// Interface fails if the interface is down.
+	Interface string `yaml:"interface"`
+	// Service fails if the number of the destinations of the service with
+	// the name which are attached with a non-zero weight and not draining
+	// is less than MinHealthy, which defaults to 1.
+	Service    string `yaml:"service"`
+	MinHealthy int    `yaml:"min_healthy"`
+	// Script fails if the command exits with a non-zero status or does not
+	// finish in Timeout, which defaults to the track interval.
+	Script  string        `yaml:"script"`
+	Timeout time.Duration `yaml:"timeout"`
+
+	Weight uint8 `yaml:"weight"`
+}
+
+// VRRPInstanceConfig is the configuration about a VRRP instance, which has
+// its own VRID and VIPs, so that nodes can be masters of different instances.
+type VRRPInstanceConfig struct {
+	Name                 string            `yaml:"name"`
+	VRID                 uint8             `yaml:"vrid"`
+	Priority             uint8             `yaml:"priority"`
+	LocalAddress         string            `yaml:"local_address"`
+	RemoteAddress        string            `yaml:"remote_address"`
+	UnicastPeers         []string          `yaml:"unicast_peers"`
+	Preempt              *bool             `yaml:"preempt"`
+	MasterAdvertInterval time.Duration     `yaml:"master_advert_interval"`
+	SendGARPInterval     time.Duration     `yaml:"send_garp_interval"`
+	VIPInterface         string            `yaml:"vip_interface"`
+	VIPs                 []string          `yaml:"vips"`
+	AuthKey              string            `yaml:"auth_key"`
+	Track                []VRRPTrackConfig `yaml:"track"`
+}
+
+// instances returns the configurations of the VRRP instances with the
+// defaults filled.
+func (c *VRRPConfig) instances() []VRRPInstanceConfig {
+	if len(c.Instances) == 0 {
+		return []VRRPInstanceConfig{{
+			VRID:                 c.VRID,
+			Priority:             c.Priority,
+			LocalAddress:         c.LocalAddress,
+			RemoteAddress:        c.RemoteAddress,
+			UnicastPeers:         c.UnicastPeers,
+			Preempt:              &c.Preempt,
+			MasterAdvertInterval: c.MasterAdvertInterval,
+			SendGARPInterval:     c.SendGARPInterval,
+			VIPInterface:         c.VIPInterface,
+			VIPs:                 c.VIPs,
+			AuthKey:              c.AuthKey,
+			Track:                c.Track,
+		}}
+	}
+	instances := make([]VRRPInstanceConfig, len(c.Instances))
+	for i, inst := range c.Instances {
+		if inst.Priority == 0 {
+			inst.Priority = c.Priority
+		}
+		if inst.LocalAddress == "" {
+			inst.LocalAddress = c.LocalAddress
+		}
+		if inst.RemoteAddress == "" && inst.UnicastPeers == nil {
+			inst.RemoteAddress = c.RemoteAddress
+			inst.UnicastPeers = c.UnicastPeers
+		}
+		if inst.Preempt == nil {
+			inst.Preempt = &c.Preempt
+		}
+		if inst.MasterAdvertInterval == 0 {
+			inst.MasterAdvertInterval = c.MasterAdvertInterval
+		}
+		if inst.SendGARPInterval == 0 {
+			inst.SendGARPInterval = c.SendGARPInterval
+		}
+		if inst.VIPInterface == "" {
+			inst.VIPInterface = c.VIPInterface
+		}
+		if inst.AuthKey == "" {
+			inst.AuthKey = c.AuthKey
+		}
+		if inst.Track == nil {
+			inst.Track = c.Track
+		}
+		instances[i] = inst
+	}
+	return instances
 }
 
 // ServiceConfig is the configuration on the service.
 type ServiceConfig struct {
 	Name         string              `yaml:"name"`
+	Protocol     string              `yaml:"protocol"`
 	Address      netutil.IP          `yaml:"address"`
 	Port         uint16              `yaml:"port"`
 	Schedule     string              `yaml:"schedule"`
 	Type         string              `yaml:"type"`
 	Destinations []DestinationConfig `yaml:"destinations"`
+
+	// HealthCheckDefaults is the defaults for the health checks of the
+	// destinations, which take precedence over Config.Defaults.
+	HealthCheckDefaults HealthCheckConfig `yaml:"health_check_defaults"`
+
+	// FWMark is the firewall mark of the service. If it is not zero,
+	// the service matches packets with the mark instead of Protocol,
+	// Address and Port, so multiple ports can be balanced as one pool.
+	FWMark uint32 `yaml:"fwmark"`
+	// AddressFamily is "inet" (default) or "inet6". It is used only for
+	// a firewall mark service.
+	AddressFamily string `yaml:"address_family"`
+
+	// PersistenceTimeout enables persistence (sticky sessions) of the
+	// service if it is not zero.
+	PersistenceTimeout time.Duration `yaml:"persistence_timeout"`
+	// PersistenceNetmask is the prefix length to group clients for
+	// persistence. The zero value means 32 for IPv4 and 128 for IPv6.
+	PersistenceNetmask uint8 `yaml:"persistence_netmask"`
+
+	// source is the included file which has the service, and sourceIndex
+	// is the index of the service in the file. source is empty for the
+	// services in the main config file. They are set by loadIncludes and
+	// used to report the location of errors.
+	source      string
+	sourceIndex int
 }
 
 // DestinationConfig is the configuration about the destination.
@@ -86,19 +237,91 @@ type DestinationConfig struct {
 	Weight      uint16            `yaml:"weight"`
 	HealthCheck HealthCheckConfig `yaml:"health_check"`
 
+	// SlowStart is the period to ramp up the weight from a small value
+	// to Weight when the destination is attached by health checks.
+	SlowStart time.Duration `yaml:"slow_start"`
+
 	Detached bool `yaml:"detached"`
 	Locked   bool `yaml:"locked"`
+
+	// successStreak and failureStreak are the numbers of consecutive
+	// successful and failed health checks.
+	successStreak int
+	failureStreak int
+
+	slowStartCancel context.CancelFunc
+	slowStartStep   int
+
+	// draining is true while the destination is drained by the drain API.
+	draining bool
+	// removed is true if the destination is removed from IPVS by the drain
+	// API. It stays removed across reloads while it is in the config.
+	removed bool
 }
 
 // HealthCheckConfig is the configuration about the health check.
 type HealthCheckConfig struct {
-	URL             string        `yaml:"url"`
-	HostHeader      string        `yaml:"host_header"`
-	EnableKeepAlive bool          `yaml:"enable_keep_alive"`
-	SkipVerifyCert  bool          `yaml:"skip_verify_cert"`
-	OKStatus        int           `yaml:"ok_status"`
-	Timeout         time.Duration `yaml:"timeout"`
-	Interval        time.Duration `yaml:"interval"`
+	// Type is "http" (default), "tcp" or a type registered with
+	// RegisterChecker. The tcp health check only connects to the
+	// destination, or to Port if it is not zero.
+	Type            string            `yaml:"type"`
+	Port            uint16            `yaml:"port"`
+	URL             string            `yaml:"url"`
+	HostHeader      string            `yaml:"host_header"`
+	ExpectBody      string            `yaml:"expect_body"`
+	EnableKeepAlive bool              `yaml:"enable_keep_alive"`
+	SkipVerifyCert  bool              `yaml:"skip_verify_cert"`
+	OKStatus        int               `yaml:"ok_status"`
+	Timeout         time.Duration     `yaml:"timeout"`
+	Interval        time.Duration     `yaml:"interval"`
+	Params          map[string]string `yaml:"params"`
+
+	// Rise is the number of consecutive successful health checks to
+	// attach a detached destination, and Fall is the number of consecutive
+	// failed health checks to detach a destination. Zero means one.
+	Rise int `yaml:"rise"`
+	Fall int `yaml:"fall"`
+
+	// enableKeepAliveSet and skipVerifyCertSet are true if the fields are
+	// set in the config, so that false there overrides true in defaults.
+	enableKeepAliveSet bool
+	skipVerifyCertSet  bool
+
+	// location is the location of this block if it is a defaults block,
+	// and origins has the locations of the defaults blocks which the
+	// fields are taken from.
+	location configLocation
+	origins  map[string]configLocation
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler to record which bool fields
+// are set.
+func (c *HealthCheckConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HealthCheckConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	_, c.enableKeepAliveSet = fields["enable_keep_alive"]
+	_, c.skipVerifyCertSet = fields["skip_verify_cert"]
+	return nil
+}
+
+func (c *HealthCheckConfig) riseCount() int {
+	if c.Rise <= 0 {
+		return 1
+	}
+	return c.Rise
+}
+
+func (c *HealthCheckConfig) fallCount() int {
+	if c.Fall <= 0 {
+		return 1
+	}
+	return c.Fall
 }
 
 type ipvsServicesAndDests struct {
@@ -134,26 +357,127 @@ func LoadConfig(file string) (*Config, error) {
 			return fmt.Errorf("failed to parse config file, err=%v", err)
 		}).String("configFile", file).Stack("")
 	}
+	c.file = file
+	c.applyDefaults()
+	err = c.loadIncludes(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	if errs := c.Validate(); len(errs) > 0 {
+		return nil, ltsvlog.Err(&ValidationError{Errors: errs}).String("configFile", file).Stack("")
+	}
 	c.updateDestinations()
 	return &c, nil
 }
 
+// parseProtocol parses the protocol of a service. The empty string means TCP.
+func parseProtocol(s string) (libipvs.Protocol, error) {
+	switch s {
+	case "", "tcp":
+		return syscall.IPPROTO_TCP, nil
+	case "udp":
+		return syscall.IPPROTO_UDP, nil
+	case "sctp":
+		return syscall.IPPROTO_SCTP, nil
+	default:
+		return 0, fmt.Errorf("unsupported protocol %q, must be tcp, udp or sctp", s)
+	}
+}
+
+// parseAddressFamily parses the address family of a firewall mark service.
+// The empty string means inet.
+func parseAddressFamily(s string) (libipvs.AddressFamily, error) {
+	switch s {
+	case "", "inet":
+		return syscall.AF_INET, nil
+	case "inet6":
+		return syscall.AF_INET6, nil
+	default:
+		return 0, fmt.Errorf("unsupported address family %q, must be inet or inet6", s)
+	}
+}
+
+func (c *ServiceConfig) protocol() libipvs.Protocol {
+	proto, _ := parseProtocol(c.Protocol)
+	return proto
+}
+
+func (c *ServiceConfig) addressFamily() libipvs.AddressFamily {
+	af, _ := parseAddressFamily(c.AddressFamily)
+	return af
+}
+
+// ipvsPersistence returns the flags, the timeout in seconds and the netmask
+// of the IPVS service for the persistence settings.
+func (c *ServiceConfig) ipvsPersistence(af libipvs.AddressFamily) (flags, timeout, netmask uint32) {
+	if c.PersistenceTimeout > 0 {
+		flags = libipvs.IP_VS_SVC_F_PERSISTENT
+		timeout = uint32((c.PersistenceTimeout + time.Second - 1) / time.Second)
+	}
+	return flags, timeout, ipvsNetmask(af, c.PersistenceNetmask)
+}
+
+// ipvsNetmask converts a prefix length to the netmask of an IPVS service.
+// IPVS expects an IPv4 netmask in network byte order and an IPv6 netmask
+// as a prefix length, both in a native endian uint32.
+func ipvsNetmask(af libipvs.AddressFamily, prefixLen uint8) uint32 {
+	if af == syscall.AF_INET6 {
+		if prefixLen == 0 || prefixLen > 128 {
+			prefixLen = 128
+		}
+		return uint32(prefixLen)
+	}
+	if prefixLen == 0 || prefixLen > 32 {
+		prefixLen = 32
+	}
+	mask := net.CIDRMask(int(prefixLen), 32)
+	return *(*uint32)(unsafe.Pointer(&mask[0]))
+}
+
+// ipvsNetmaskPrefixLen is the inverse of ipvsNetmask.
+func ipvsNetmaskPrefixLen(af libipvs.AddressFamily, netmask uint32) uint8 {
+	if af == syscall.AF_INET6 {
+		return uint8(netmask)
+	}
+	mask := make(net.IPMask, 4)
+	*(*uint32)(unsafe.Pointer(&mask[0])) = netmask
+	ones, _ := mask.Size()
+	return uint8(ones)
+}
+
+func (c *ServiceConfig) serviceKey() string {
+	if c.FWMark != 0 {
+		return fwmarkServiceKey(c.addressFamily(), c.FWMark)
+	}
+	return serviceKey(c.protocol(), net.IP(c.Address), c.Port)
+}
+
 func (c *Config) updateDestinations() {
 	c.destinations = make(map[string]*DestinationConfig)
 	for i := range c.Services {
 		s := &c.Services[i]
 		for j := range s.Destinations {
 			dest := &s.Destinations[j]
-			key := destinationKey(net.IP(s.Address), s.Port, net.IP(dest.Address), dest.Port)
+			key := destinationKey(s.serviceKey(), net.IP(dest.Address), dest.Port)
 			c.destinations[key] = dest
 		}
 	}
 }
 
-func (c *Config) findService(addr net.IP, port uint16) *ServiceConfig {
+func (c *Config) findService(svcKey string) *ServiceConfig {
+	for i := range c.Services {
+		s := &c.Services[i]
+		if s.serviceKey() == svcKey {
+			return s
+		}
+	}
+	return nil
+}
+
+func (c *Config) findServiceByName(name string) *ServiceConfig {
 	for i := range c.Services {
 		s := &c.Services[i]
-		if net.IP(s.Address).Equal(addr) && s.Port == port {
+		if s.Name == name {
 			return s
 		}
 	}
@@ -174,10 +498,9 @@ func (c *ServiceConfig) findDestination(addr net.IP, port uint16) *DestinationCo
 	return nil
 }
 
-func (s *ipvsServicesAndDests) findService(addr net.IP, port uint16) *ipvsServiceAndDests {
+func (s *ipvsServicesAndDests) findService(svcKey string) *ipvsServiceAndDests {
 	for _, serviceAndDests := range s.services {
-		sv := serviceAndDests.service
-		if sv.Address.Equal(addr) && sv.Port == port {
+		if ipvsServiceKey(serviceAndDests.service) == svcKey {
 			return serviceAndDests
 		}
 	}
@@ -194,9 +517,26 @@ func (s *ipvsServiceAndDests) findDestination(addr net.IP, port uint16) *ipvsDes
 	return nil
 }
 
-func destinationKey(srcIP net.IP, srcPort uint16, destIP net.IP, destPort uint16) string {
-	return net.JoinHostPort(srcIP.String(), strconv.Itoa(int(srcPort))) + "," +
-		net.JoinHostPort(destIP.String(), strconv.Itoa(int(destPort)))
+// serviceKey returns the key to identify a service, for example "udp/192.0.2.1:53".
+func serviceKey(proto libipvs.Protocol, addr net.IP, port uint16) string {
+	return proto.String() + "/" + net.JoinHostPort(addr.String(), strconv.Itoa(int(port)))
+}
+
+// fwmarkServiceKey returns the key to identify a firewall mark service,
+// for example "inet/fwmark:1".
+func fwmarkServiceKey(af libipvs.AddressFamily, mark uint32) string {
+	return af.String() + "/fwmark:" + strconv.FormatUint(uint64(mark), 10)
+}
+
+func ipvsServiceKey(s *libipvs.Service) string {
+	if s.FWMark != 0 {
+		return fwmarkServiceKey(s.AddressFamily, s.FWMark)
+	}
+	return serviceKey(s.Protocol, s.Address, s.Port)
+}
+
+func destinationKey(svcKey string, destIP net.IP, destPort uint16) string {
+	return svcKey + "," + net.JoinHostPort(destIP.String(), strconv.Itoa(int(destPort)))
 }
 
 func (s *ipvsServicesAndDests) findDestination(destKey string) *ipvsDestination {
@@ -228,7 +568,7 @@ func listServicesAndDests(h libipvs.IPVSHandle) (*ipvsServicesAndDests, error) {
 		}
 		for j, dest := range dests {
 			destination := &ipvsDestination{destination: dest, service: service}
-			destKey := destinationKey(service.Address, service.Port, dest.Address, dest.Port)
+			destKey := destinationKey(ipvsServiceKey(service), dest.Address, dest.Port)
 			servicesAndDests.destinations[destKey] = destination
 			serviceAndDests.destinations[j] = destination
 		}
@@ -249,6 +589,10 @@ func (c *Config) totalServiceCount() int {
 
 // New returns a new load balancer.
 func New(config *Config) (*LoadBalancer, error) {
+	if errs := config.Validate(); len(errs) > 0 {
+		return nil, ltsvlog.Err(&ValidationError{Errors: errs}).Stack("")
+	}
+
 	ipvs, err := libipvs.New()
 	if err != nil {
 		return nil, ltsvlog.WrapErr(err, func(err error) error {
@@ -256,34 +600,85 @@ func New(config *Config) (*LoadBalancer, error) {
 		}).Stack("")
 	}
 
-	node, err := newVRRPNode(&config.VRRP)
+	nodes, err := newVRRPNodes(&config.VRRP)
 	if err != nil {
 		return nil, err
 	}
 
-	return &LoadBalancer{
-		config:   config,
-		ipvs:     ipvs,
-		vrrpNode: node,
-		checkers: newHealthcheckers(),
-	}, nil
+	l := &LoadBalancer{
+		config:    config,
+		ipvs:      ipvs,
+		vrrpNodes: nodes,
+		checkers:  newHealthcheckers(),
+		reloadC:   make(chan *reloadRequest),
+	}
+	for _, node := range nodes {
+		node := node
+		node.onStateChange = func(oldState, state haState) {
+			l.notifyVRRPState(node, oldState, state)
+		}
+	}
+	return l, nil
 }
 
-func newVRRPNode(vrrpCfg *VRRPConfig) (*haNode, error) {
+// validateVRRPTrack returns an error if t is invalid.
+func (c *Config) validateVRRPTrack(t *VRRPTrackConfig) error {
+	n := 0
+	for _, s := range []string{t.Interface, t.Service, t.Script} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return errors.New("exactly one of interface, service and script must be set")
+	}
+	if t.Service != "" && c.findServiceByName(t.Service) == nil {
+		return fmt.Errorf("service %q not found", t.Service)
+	}
+	return nil
+}
+
+func newVRRPNodes(vrrpCfg *VRRPConfig) ([]*haNode, error) {
 	if !vrrpCfg.Enabled {
 		return nil, nil
 	}
 
+	instances := vrrpCfg.instances()
+	nodes := make([]*haNode, len(instances))
+	for i := range instances {
+		node, err := newVRRPNode(&instances[i])
+		if err != nil {
+			return nil, ltsvlog.WrapErr(err, nil).String("instance", instances[i].Name).Uint8("vrid", instances[i].VRID)
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func newVRRPNode(vrrpCfg *VRRPInstanceConfig) (*haNode, error) {
 	localAddr := net.ParseIP(vrrpCfg.LocalAddress)
 	if localAddr == nil {
 		return nil, ltsvlog.Err(fmt.Errorf("invalid local IP address (%s)", vrrpCfg.LocalAddress)).
 			String("localAddress", vrrpCfg.LocalAddress).Stack("")
 	}
 
-	remoteAddr := net.ParseIP(vrrpCfg.RemoteAddress)
-	if remoteAddr == nil {
-		return nil, ltsvlog.Err(fmt.Errorf("invalid remote IP address (%s)", vrrpCfg.LocalAddress)).
-			String("remoteAddress", vrrpCfg.LocalAddress).Stack("")
+	var remoteAddr net.IP
+	var unicastPeers []net.IP
+	if len(vrrpCfg.UnicastPeers) > 0 {
+		for _, peer := range vrrpCfg.UnicastPeers {
+			ip := net.ParseIP(peer)
+			if ip == nil || ip.IsMulticast() || (ip.To4() != nil) != (localAddr.To4() != nil) {
+				return nil, ltsvlog.Err(fmt.Errorf("invalid unicast peer IP address (%s)", peer)).
+					String("unicastPeer", peer).Stack("")
+			}
+			unicastPeers = append(unicastPeers, ip)
+		}
+	} else {
+		remoteAddr = net.ParseIP(vrrpCfg.RemoteAddress)
+		if remoteAddr == nil {
+			return nil, ltsvlog.Err(fmt.Errorf("invalid remote IP address (%s)", vrrpCfg.RemoteAddress)).
+				String("remoteAddress", vrrpCfg.RemoteAddress).Stack("")
+		}
 	}
 
 	vipIntf, err := net.InterfaceByName(vrrpCfg.VIPInterface)
@@ -294,29 +689,32 @@ func newVRRPNode(vrrpCfg *VRRPConfig) (*haNode, error) {
 	}
 	vipCfgs := make([]*haEngineVIPConfig, len(vrrpCfg.VIPs))
 	for i, vip := range vrrpCfg.VIPs {
-		ip, ipNet, err := net.ParseCIDR(vip)
+		vipCfg, err := parseVIP(vip)
 		if err != nil {
 			return nil, ltsvlog.WrapErr(err, func(err error) error {
-				return fmt.Errorf("failed to parse CIDR %s, err=%v", vip, err)
+				return fmt.Errorf("failed to parse VIP %s, err=%v", vip, err)
 			}).String("vip", vip).Stack("")
 		}
-		vipCfgs[i] = &haEngineVIPConfig{ip: ip, ipNet: ipNet}
+		vipCfgs[i] = vipCfg
 	}
 
 	haCfg := haConfig{
-		Enabled:    true,
-		LocalAddr:  localAddr,
-		RemoteAddr: remoteAddr,
-		Priority:   vrrpCfg.Priority,
-		VRID:       vrrpCfg.VRID,
+		Enabled:      true,
+		LocalAddr:    localAddr,
+		RemoteAddr:   remoteAddr,
+		UnicastPeers: unicastPeers,
+		Priority:     vrrpCfg.Priority,
+		VRID:         vrrpCfg.VRID,
 	}
 	nc := haNodeConfig{
 		haConfig:             haCfg,
+		Name:                 vrrpCfg.Name,
 		MasterAdvertInterval: vrrpCfg.MasterAdvertInterval,
-		Preempt:              vrrpCfg.Preempt,
+		Preempt:              *vrrpCfg.Preempt,
+		Tracks:               vrrpCfg.Track,
 	}
 
-	conn, err := newIPHAConn(localAddr, remoteAddr)
+	conn, err := newIPHAConn(localAddr, haCfg.peers(), vrrpCfg.AuthKey)
 	if err != nil {
 		return nil, err
 	}
@@ -343,17 +741,25 @@ func (l *LoadBalancer) Run(ctx context.Context, listeners []net.Listener) error
 		})
 	}
 	var wg sync.WaitGroup
-	if l.vrrpNode != nil {
+	for _, node := range l.vrrpNodes {
 		wg.Add(1)
+		node := node
 		go func() {
 			defer wg.Done()
-			l.vrrpNode.run(ctx)
+			node.run(ctx)
 		}()
+		if len(node.Tracks) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				l.runVRRPTracker(ctx, node)
+			}()
+		}
 	}
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		l.runHealthCheckLoop(ctx, l.config)
+		l.runHealthCheckLoop(ctx)
 	}()
 	if l.config.API.ListenAddress != "" {
 		wg.Add(1)
@@ -367,6 +773,7 @@ func (l *LoadBalancer) Run(ctx context.Context, listeners []net.Listener) error
 		ltsvlog.Logger.Debug().String("msg", "LoadBalancer.Run ctx canceled").Log()
 	}
 	wg.Wait()
+	l.closeNotifier()
 	if ltsvlog.Logger.DebugEnabled() {
 		ltsvlog.Logger.Debug().String("msg", "exiting Run").Log()
 	}
@@ -377,6 +784,10 @@ func (l *LoadBalancer) applyConfig(ctx context.Context, config *Config) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if l.config != nil && l.config != config {
+		config.inheritRuntimeState(l.config)
+	}
+
 	servicesAndDests, err := listServicesAndDests(l.ipvs)
 	if err != nil {
 		return ltsvlog.WrapErr(err, func(err error) error {
@@ -406,6 +817,7 @@ func (l *LoadBalancer) applyConfig(ctx context.Context, config *Config) error {
 	}
 
 	l.config = config
+	l.setNotifyHooks(config.Notify)
 	return nil
 }
 
@@ -427,46 +839,74 @@ func (l *LoadBalancer) doAddOrUpdateIPVS(ctx context.Context, config *Config, se
 	for i := range config.Services {
 		serviceConf := &config.Services[i]
 		var service *libipvs.Service
-		serviceConfIP := net.IP(serviceConf.Address)
-		serviceAndDests := servicesAndDests.findService(serviceConfIP, serviceConf.Port)
+		svcKey := serviceConf.serviceKey()
+		serviceAndDests := servicesAndDests.findService(svcKey)
 		if serviceAndDests == nil {
-			family := libipvs.AddressFamily(ipAddressFamily(serviceConfIP))
-			service = &libipvs.Service{
-				Address:       serviceConfIP,
-				AddressFamily: family,
-				Protocol:      libipvs.Protocol(syscall.IPPROTO_TCP),
-				Port:          serviceConf.Port,
-				SchedName:     serviceConf.Schedule,
+			if serviceConf.FWMark != 0 {
+				service = &libipvs.Service{
+					FWMark:        serviceConf.FWMark,
+					AddressFamily: serviceConf.addressFamily(),
+					SchedName:     serviceConf.Schedule,
+				}
+			} else {
+				serviceConfIP := net.IP(serviceConf.Address)
+				service = &libipvs.Service{
+					Address:       serviceConfIP,
+					AddressFamily: libipvs.AddressFamily(ipAddressFamily(serviceConfIP)),
+					Protocol:      serviceConf.protocol(),
+					Port:          serviceConf.Port,
+					SchedName:     serviceConf.Schedule,
+				}
 			}
+			flags, timeout, netmask := serviceConf.ipvsPersistence(service.AddressFamily)
+			service.Flags = libipvs.Flags{Flags: flags, Mask: ^uint32(0)}
+			service.Timeout = timeout
+			service.Netmask = netmask
 			err := l.ipvs.NewService(service)
 			if err != nil {
 				return ltsvlog.WrapErr(err, func(err error) error {
 					return fmt.Errorf("failed to create ipvs service, err=%s", err)
-				}).Stringer("srcIP", serviceConfIP).Uint16("srcPort", serviceConf.Port).
-					String("schedule", serviceConf.Schedule).Stack("")
+				}).String("service", svcKey).
+					String("schedule", serviceConf.Schedule).
+					Uint32("persistenceTimeout", timeout).Uint8("persistenceNetmask", serviceConf.PersistenceNetmask).Stack("")
 			}
 			ltsvlog.Logger.Info().String("msg", "added ipvs service").
-				Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
-				String("schedule", serviceConf.Schedule).Log()
+				String("service", svcKey).
+				String("schedule", serviceConf.Schedule).
+				Uint32("persistenceTimeout", timeout).Uint8("persistenceNetmask", serviceConf.PersistenceNetmask).Log()
 		} else {
 			service = serviceAndDests.service
-			if serviceConf.Schedule != service.SchedName {
+			flags, timeout, netmask := serviceConf.ipvsPersistence(service.AddressFamily)
+			if serviceConf.Schedule != service.SchedName ||
+				service.Flags.Flags&libipvs.IP_VS_SVC_F_PERSISTENT != flags ||
+				service.Timeout != timeout || service.Netmask != netmask {
 				service.SchedName = serviceConf.Schedule
+				service.Flags = libipvs.Flags{
+					Flags: service.Flags.Flags&^libipvs.IP_VS_SVC_F_PERSISTENT | flags,
+					Mask:  ^uint32(0),
+				}
+				service.Timeout = timeout
+				service.Netmask = netmask
 				err := l.ipvs.UpdateService(service)
 				if err != nil {
 					return ltsvlog.WrapErr(err, func(err error) error {
 						return fmt.Errorf("failed to update ipvs service, err=%s", err)
-					}).Stringer("srcIP", serviceConfIP).Uint16("srcPort", serviceConf.Port).
-						String("schedule", serviceConf.Schedule).Stack("")
+					}).String("service", svcKey).
+						String("schedule", serviceConf.Schedule).
+						Uint32("persistenceTimeout", timeout).Uint8("persistenceNetmask", serviceConf.PersistenceNetmask).Stack("")
 				}
 				ltsvlog.Logger.Info().String("msg", "updated ipvs service").
-					Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
-					String("schedule", serviceConf.Schedule).Log()
+					String("service", svcKey).
+					String("schedule", serviceConf.Schedule).
+					Uint32("persistenceTimeout", timeout).Uint8("persistenceNetmask", serviceConf.PersistenceNetmask).Log()
 			}
 		}
 
 		for j := range serviceConf.Destinations {
 			destConf := &serviceConf.Destinations[j]
+			if destConf.removed {
+				continue
+			}
 			err := l.addOrUpdateDestination(ctx, service, serviceAndDests, serviceConf, destConf)
 			if err != nil {
 				return err
@@ -488,6 +928,10 @@ func (l *LoadBalancer) addOrUpdateDestination(ctx context.Context, service *libi
 	}
 
 	destConfIP := net.IP(destConf.Address)
+	weight := destConf.Weight
+	if destConf.Detached || destConf.draining {
+		weight = 0
+	}
 
 	var dest *ipvsDestination
 	if serviceAndDests != nil {
@@ -500,37 +944,41 @@ func (l *LoadBalancer) addOrUpdateDestination(ctx context.Context, service *libi
 			AddressFamily: family,
 			Port:          destConf.Port,
 			FwdMethod:     fwd,
-			Weight:        uint32(destConf.Weight),
+			Weight:        uint32(weight),
 		}
 		err := l.ipvs.NewDestination(service, destination)
 		if err != nil {
 			return ltsvlog.WrapErr(err, func(err error) error {
 				return fmt.Errorf("failed to create ipvs destination, err=%s", err)
-			}).Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
+			}).String("service", ipvsServiceKey(service)).
 				Stringer("destIP", destConfIP).Uint16("destPort", destConf.Port).
-				String("fwdMethod", serviceConf.Type).Uint16("weight", destConf.Weight).Stack("")
+				String("fwdMethod", serviceConf.Type).Uint16("weight", weight).Stack("")
 		}
 		ltsvlog.Logger.Info().String("msg", "added ipvs destination").
-			Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
+			String("service", ipvsServiceKey(service)).
 			Stringer("destIP", destConfIP).Uint16("destPort", destConf.Port).
-			String("fwdMethod", serviceConf.Type).Uint16("weight", destConf.Weight).Log()
+			String("fwdMethod", serviceConf.Type).Uint16("weight", weight).Log()
 	} else {
 		destination := dest.destination
-		if fwd != destination.FwdMethod || uint32(destConf.Weight) != destination.Weight {
+		if destConf.slowStartCancel != nil {
+			// Keep the weight which is being ramped up.
+			weight = uint16(destination.Weight)
+		}
+		if fwd != destination.FwdMethod || uint32(weight) != destination.Weight {
 			destination.FwdMethod = fwd
-			destination.Weight = uint32(destConf.Weight)
+			destination.Weight = uint32(weight)
 			err := l.ipvs.UpdateDestination(service, destination)
 			if err != nil {
 				return ltsvlog.WrapErr(err, func(err error) error {
 					return fmt.Errorf("failed to update ipvs destination, err=%s", err)
-				}).Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
+				}).String("service", ipvsServiceKey(service)).
 					Stringer("destIP", destConfIP).Uint16("destPort", destConf.Port).
-					String("fwdMethod", serviceConf.Type).Uint16("weight", destConf.Weight).Stack("")
+					String("fwdMethod", serviceConf.Type).Uint16("weight", weight).Stack("")
 			}
 			ltsvlog.Logger.Info().String("msg", "updated ipvs destination").
-				Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
+				String("service", ipvsServiceKey(service)).
 				Stringer("destIP", destConfIP).Uint16("destPort", destConf.Port).
-				String("fwdMethod", serviceConf.Type).Uint16("weight", destConf.Weight).Log()
+				String("fwdMethod", serviceConf.Type).Uint16("weight", weight).Log()
 		}
 	}
 	return nil
@@ -539,7 +987,7 @@ func (l *LoadBalancer) addOrUpdateDestination(ctx context.Context, service *libi
 func (l *LoadBalancer) doDeleteIPVS(ctx context.Context, config *Config, servicesAndDests *ipvsServicesAndDests) error {
 	for _, serviceAndDests := range servicesAndDests.services {
 		service := serviceAndDests.service
-		serviceConf := config.findService(service.Address, service.Port)
+		serviceConf := config.findService(ipvsServiceKey(service))
 		if serviceConf == nil {
 			for _, dest := range serviceAndDests.destinations {
 				destination := dest.destination
@@ -558,12 +1006,12 @@ func (l *LoadBalancer) doDeleteIPVS(ctx context.Context, config *Config, service
 				}).Stringer("serviceAddress", service.Address).Stack("")
 			}
 			ltsvlog.Logger.Info().String("msg", "deleted ipvs service").
-				Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).Log()
+				String("service", ipvsServiceKey(service)).Log()
 		} else {
 			for _, dest := range serviceAndDests.destinations {
 				destination := dest.destination
 				destConf := serviceConf.findDestination(net.IP(destination.Address), destination.Port)
-				if destConf == nil {
+				if destConf == nil || destConf.removed {
 					err := l.ipvs.DelDestination(service, destination)
 					if err != nil {
 						return ltsvlog.WrapErr(err, func(err error) error {
@@ -571,7 +1019,7 @@ func (l *LoadBalancer) doDeleteIPVS(ctx context.Context, config *Config, service
 						}).Stack("")
 					}
 					ltsvlog.Logger.Info().String("msg", "deleted ipvs destination").
-						Stringer("srcIP", service.Address).Uint16("srcPort", service.Port).
+						String("service", ipvsServiceKey(service)).
 						Stringer("destIP", destination.Address).Uint16("destPort", destination.Port).Log()
 				}
 			}
@@ -587,26 +1035,29 @@ func ipAddressFamily(ip net.IP) int {
 	return syscall.AF_INET6
 }
 
-func (l *LoadBalancer) runHealthCheckLoop(ctx context.Context, config *Config) {
+func (l *LoadBalancer) runHealthCheckLoop(ctx context.Context) {
 	l.mu.Lock()
-	l.checkResultC = make(chan healthcheckResult, config.totalServiceCount())
-	l.doUpdateCheckers(ctx, config)
+	l.checkResultC = make(chan healthcheckResult, l.config.totalServiceCount())
+	l.doUpdateCheckers(ctx, l.config)
 	l.mu.Unlock()
 
 	for {
 		select {
 		case result := <-l.checkResultC:
-			err := l.attachOrDetachDestinationByHealthCheck(ctx, config, &result)
+			err := l.attachOrDetachDestinationByHealthCheck(ctx, &result)
 			if err != nil {
 				ltsvlog.Logger.Err(err)
 			}
+		case req := <-l.reloadC:
+			ignored, err := l.reloadConfig(ctx, req.config)
+			req.resultC <- reloadResult{ignored: ignored, err: err}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (l *LoadBalancer) attachOrDetachDestinationByHealthCheck(ctx context.Context, config *Config, result *healthcheckResult) error {
+func (l *LoadBalancer) attachOrDetachDestinationByHealthCheck(ctx context.Context, result *healthcheckResult) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -616,78 +1067,115 @@ func (l *LoadBalancer) attachOrDetachDestinationByHealthCheck(ctx context.Contex
 	}
 
 	dest := l.servicesAndDests.findDestination(result.DestinationKey)
+	if dest == nil {
+		// The destination was deleted by reloading config after the
+		// health check was started.
+		if ltsvlog.Logger.DebugEnabled() {
+			ltsvlog.Logger.Debug().String("msg", "ignore healthcheck result for deleted destination").
+				String("destKey", result.DestinationKey).Log()
+		}
+		return nil
+	}
 	service := dest.service
 	destination := dest.destination
-	destConf := config.findDestination(result.DestinationKey)
+	destConf := l.config.findDestination(result.DestinationKey)
 	if destConf == nil {
 		return ltsvlog.Err(errors.New("destination config not found for healthcheck")).
-			Stringer("srvIP", service.Address).
-			Uint16("srvPort", service.Port).
+			String("service", ipvsServiceKey(service)).
 			Stringer("destIP", destination.Address).
 			Uint16("destPort", destination.Port).Stack("")
 	}
 	if result.OK && result.Err == nil {
+		destConf.successStreak++
+		destConf.failureStreak = 0
+		if destConf.successStreak < destConf.HealthCheck.riseCount() {
+			return nil
+		}
 		if destination.Weight != uint32(destConf.Weight) {
 			if destConf.Locked {
 				if ltsvlog.Logger.DebugEnabled() {
 					ltsvlog.Logger.Debug().String("msg", "skip attaching locked destination").
-						Stringer("srvIP", service.Address).
-						Uint16("srvPort", service.Port).
+						String("service", ipvsServiceKey(service)).
 						Stringer("destIP", destination.Address).
 						Uint16("destPort", destination.Port).Log()
 				}
 				return nil
 			}
 
-			destination.Weight = uint32(destConf.Weight)
+			if destConf.slowStartCancel != nil {
+				// The weight is being ramped up.
+				return nil
+			}
+
+			weight := destConf.Weight
+			slowStart := destConf.SlowStart > 0 && destConf.Detached
+			if slowStart {
+				weight = slowStartWeight(destConf.Weight, 1)
+			}
+			destination.Weight = uint32(weight)
 			err := l.ipvs.UpdateDestination(service, destination)
 			if err != nil {
 				return ltsvlog.WrapErr(err, func(err error) error {
 					return fmt.Errorf("faild to attach ipvs destination, err=%s", err)
-				}).Stringer("srvIP", service.Address).
-					Uint16("srvPort", service.Port).
+				}).String("service", ipvsServiceKey(service)).
 					Stringer("destIP", destination.Address).
 					Uint16("destPort", destination.Port).
 					Uint16("cfgWeight", destConf.Weight).
 					Stack("")
 			}
+			wasDetached := destConf.Detached
 			destConf.Detached = false
+			if slowStart {
+				l.startSlowStart(ctx, result.DestinationKey, destConf)
+			}
+			if wasDetached {
+				l.notifyDestination(service, destination, "attach")
+			}
 			ltsvlog.Logger.Info().String("msg", "attached destination").
-				Stringer("srvIP", service.Address).
-				Uint16("srvPort", service.Port).
+				String("service", ipvsServiceKey(service)).
 				Stringer("destIP", destination.Address).
 				Uint16("destPort", destination.Port).
-				Uint16("cfgWeight", destConf.Weight).Log()
+				Uint16("cfgWeight", destConf.Weight).
+				Uint16("weight", weight).Bool("slowStart", slowStart).Log()
 		}
 	} else {
+		destConf.failureStreak++
+		destConf.successStreak = 0
+		if destConf.failureStreak < destConf.HealthCheck.fallCount() {
+			if ltsvlog.Logger.DebugEnabled() {
+				ltsvlog.Logger.Debug().String("msg", "healthcheck failed but not reached fall count").
+					String("destKey", result.DestinationKey).
+					Int("failureStreak", destConf.failureStreak).Log()
+			}
+			return nil
+		}
 		if destination.Weight != 0 {
 			if destConf.Locked {
 				if ltsvlog.Logger.DebugEnabled() {
 					ltsvlog.Logger.Debug().String("msg", "skip detaching locked destination").
-						Stringer("srvIP", service.Address).
-						Uint16("srvPort", service.Port).
+						String("service", ipvsServiceKey(service)).
 						Stringer("destIP", destination.Address).
 						Uint16("destPort", destination.Port).Log()
 				}
 				return nil
 			}
 
+			destConf.stopSlowStart()
 			destination.Weight = 0
 			err := l.ipvs.UpdateDestination(service, destination)
 			if err != nil {
 				return ltsvlog.WrapErr(err, func(err error) error {
 					return fmt.Errorf("faild to detach ipvs destination, err=%s", err)
-				}).Stringer("srvIP", service.Address).
-					Uint16("srvPort", service.Port).
+				}).String("service", ipvsServiceKey(service)).
 					Stringer("destIP", destination.Address).
 					Uint16("destPort", destination.Port).
 					Uint16("cfgWeight", destConf.Weight).
 					Stack("")
 			}
 			destConf.Detached = true
+			l.notifyDestination(service, destination, "detach")
 			ltsvlog.Logger.Info().String("msg", "detached destination").
-				Stringer("srvIP", service.Address).
-				Uint16("srvPort", service.Port).
+				String("service", ipvsServiceKey(service)).
 				Stringer("destIP", destination.Address).
 				Uint16("destPort", destination.Port).
 				Uint16("cfgWeight", destConf.Weight).Log()
@@ -696,7 +1184,7 @@ func (l *LoadBalancer) attachOrDetachDestinationByHealthCheck(ctx context.Contex
 	return nil
 }
 
-func (l *LoadBalancer) changeWeight(ctx context.Context, srvIP net.IP, srvPort uint16, destIP net.IP, destPort uint16, weight uint16, lock bool) error {
+func (l *LoadBalancer) changeWeight(ctx context.Context, svcKey string, destIP net.IP, destPort uint16, weight uint16, lock bool) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -705,70 +1193,74 @@ func (l *LoadBalancer) changeWeight(ctx context.Context, srvIP net.IP, srvPort u
 		return err
 	}
 
-	destKey := destinationKey(srvIP, srvPort, destIP, destPort)
+	destKey := destinationKey(svcKey, destIP, destPort)
 	dest := l.servicesAndDests.findDestination(destKey)
 	if dest == nil {
 		return ltsvlog.Err(errors.New("no destination found")).
-			Stringer("srvIP", srvIP).Uint16("srvPort", srvPort).
-			Stringer("destIP", destIP).Uint16("destPort", destPort).Stack("")
+			String("service", svcKey).Stringer("destIP", destIP).Uint16("destPort", destPort).Stack("")
 	}
 	service := dest.service
 	destination := dest.destination
 	destConf := l.config.findDestination(destKey)
 	if destConf == nil {
 		return ltsvlog.Err(errors.New("no destination config found")).
-			Stringer("srvIP", srvIP).Uint16("srvPort", srvPort).
-			Stringer("destIP", destIP).Uint16("destPort", destPort).Stack("")
+			String("service", svcKey).Stringer("destIP", destIP).Uint16("destPort", destPort).Stack("")
 	}
 
+	destConf.stopSlowStart()
 	destination.Weight = uint32(weight)
 	err = l.ipvs.UpdateDestination(service, destination)
 	if err != nil {
 		return ltsvlog.WrapErr(err, func(err error) error {
 			return fmt.Errorf("faild to change ipvs destination weight, err=%s", err)
-		}).Stringer("srvIP", srvIP).Uint16("srvPort", srvPort).
-			Stringer("destIP", destIP).Uint16("destPort", destPort).
+		}).String("service", svcKey).Stringer("destIP", destIP).Uint16("destPort", destPort).
 			Uint16("weight", weight).Stack("")
 	}
 	destConf.Weight = weight
 	destConf.Locked = lock
+	destConf.draining = false
 	ltsvlog.Logger.Info().String("msg", "changed destination weight").
-		Stringer("srvIP", srvIP).Uint16("srvPort", srvPort).
-		Stringer("destIP", destIP).Uint16("destPort", destPort).
+		String("service", svcKey).Stringer("destIP", destIP).Uint16("destPort", destPort).
 		Uint16("weight", weight).Bool("lock", lock).Log()
 	return nil
 }
 
 func (l *LoadBalancer) doUpdateCheckers(ctx context.Context, config *Config) {
+	desired := make(map[string]*healthcheckerConfig)
 	for _, serviceConf := range config.Services {
 		for _, destConf := range serviceConf.Destinations {
-			c := destConf.HealthCheck
+			if destConf.removed {
+				continue
+			}
 			if ltsvlog.Logger.DebugEnabled() {
 				ltsvlog.Logger.Debug().String("msg", "doUpdateCheckers").Stringer("destAddr", net.IP(destConf.Address)).Uint16("destPort", destConf.Port).Log()
 			}
-			destKey := destinationKey(net.IP(serviceConf.Address), serviceConf.Port, net.IP(destConf.Address), destConf.Port)
-			cfg := &healthcheckerConfig{
+			destKey := destinationKey(serviceConf.serviceKey(), net.IP(destConf.Address), destConf.Port)
+			healthCheck := destConf.HealthCheck
+			err := healthCheck.expandTemplates(newHealthCheckTemplateData(&serviceConf, &destConf))
+			if err != nil {
+				ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
+					return fmt.Errorf("failed to expand health check templates, err=%v", err)
+				}).String("destKey", destKey).Stack(""))
+				continue
+			}
+			desired[destKey] = &healthcheckerConfig{
 				DestinationKey: destKey,
-				Method:         http.MethodGet,
-				URL:            c.URL,
-				HostHeader:     c.HostHeader,
-				SkipVerifyCert: c.SkipVerifyCert,
-				IsOK: func(res *http.Response) (bool, error) {
-					if res.StatusCode != c.OKStatus {
-						ltsvlog.Logger.Info().String("msg", "healthcheck status unmatch").Int("status", res.StatusCode).Int("okStatus", c.OKStatus).Log()
-					}
-					return res.StatusCode == c.OKStatus, nil
+				Checker: CheckerConfig{
+					DestinationAddress: net.IP(destConf.Address),
+					DestinationPort:    destConf.Port,
+					HealthCheck:        healthCheck,
 				},
-				Timeout:  c.Timeout,
-				Interval: c.Interval,
 			}
-			l.checkers.startHealthchecker(ctx, cfg, l.checkResultC)
 		}
 	}
+	l.checkers.syncHealthcheckers(ctx, desired, l.checkResultC)
 }
 
 func (l *LoadBalancer) SetKeepVIPsDuringRestart(keep bool) {
-	l.vrrpNode.SetKeepVIPsDuringRestart(keep)
+	for _, node := range l.vrrpNodes {
+		node.SetKeepVIPsDuringRestart(keep)
+	}
 }
 
 type ipvsServiceAndDestsByIPAndPort []*ipvsServiceAndDests
@@ -778,13 +1270,18 @@ func (a ipvsServiceAndDestsByIPAndPort) Swap(i, j int) { a[i], a[j] = a[j], a[i]
 func (a ipvsServiceAndDestsByIPAndPort) Less(i, j int) bool {
 	si := a[i].service
 	sj := a[j].service
+	if si.FWMark != sj.FWMark {
+		return si.FWMark < sj.FWMark
+	}
 	c := bytes.Compare(si.Address, sj.Address)
 	if c < 0 {
 		return true
 	} else if c > 0 {
 		return false
-	} else {
+	} else if si.Port != sj.Port {
 		return si.Port < sj.Port
+	} else {
+		return si.Protocol < sj.Protocol
 	}
 }
 
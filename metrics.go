@@ -0,0 +1,214 @@
+package goloba
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mqliang/libipvs"
+)
+
+// metricsBuilder builds metrics in the Prometheus text exposition format.
+// Samples are grouped by the metric name in the order of the first addition.
+type metricsBuilder struct {
+	families []*metricFamily
+	index    map[string]*metricFamily
+}
+
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []metricSample
+}
+
+type metricSample struct {
+	suffix string
+	labels []metricLabel
+	value  float64
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+func newMetricsBuilder() *metricsBuilder {
+	return &metricsBuilder{index: make(map[string]*metricFamily)}
+}
+
+func (b *metricsBuilder) family(name, typ, help string) *metricFamily {
+	f, ok := b.index[name]
+	if !ok {
+		f = &metricFamily{name: name, typ: typ, help: help}
+		b.families = append(b.families, f)
+		b.index[name] = f
+	}
+	return f
+}
+
+func (b *metricsBuilder) gauge(name, help string, value float64, labels ...metricLabel) {
+	f := b.family(name, "gauge", help)
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func (b *metricsBuilder) counter(name, help string, value float64, labels ...metricLabel) {
+	f := b.family(name, "counter", help)
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+// summary adds a summary without quantiles, that is only the sum and count.
+func (b *metricsBuilder) summary(name, help string, sum float64, count uint64, labels ...metricLabel) {
+	f := b.family(name, "summary", help)
+	f.samples = append(f.samples,
+		metricSample{suffix: "_sum", labels: labels, value: sum},
+		metricSample{suffix: "_count", labels: labels, value: float64(count)})
+}
+
+func (b *metricsBuilder) writeTo(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range b.families {
+		bw.WriteString("# HELP " + f.name + " " + escapeMetricHelp(f.help) + "\n")
+		bw.WriteString("# TYPE " + f.name + " " + f.typ + "\n")
+		for _, s := range f.samples {
+			bw.WriteString(f.name + s.suffix)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(l.name + `="` + escapeMetricLabelValue(l.value) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	metricHelpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	metricLabelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeMetricHelp(s string) string {
+	return metricHelpEscaper.Replace(s)
+}
+
+func escapeMetricLabelValue(s string) string {
+	return metricLabelValueEscaper.Replace(s)
+}
+
+func boolMetricValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// addIPVSStats adds the metrics of IPVS stats with the prefix which is
+// goloba_service or goloba_destination.
+func (b *metricsBuilder) addIPVSStats(prefix string, stats libipvs.Stats, labels ...metricLabel) {
+	b.counter(prefix+"_connections_total", "Total number of connections.", float64(stats.Connections), labels...)
+	b.counter(prefix+"_packets_in_total", "Total number of incoming packets.", float64(stats.PacketsIn), labels...)
+	b.counter(prefix+"_packets_out_total", "Total number of outgoing packets.", float64(stats.PacketsOut), labels...)
+	b.counter(prefix+"_bytes_in_total", "Total number of incoming bytes.", float64(stats.BytesIn), labels...)
+	b.counter(prefix+"_bytes_out_total", "Total number of outgoing bytes.", float64(stats.BytesOut), labels...)
+	b.gauge(prefix+"_connections_per_second", "Rate of connections per second.", float64(stats.CPS), labels...)
+	b.gauge(prefix+"_packets_in_per_second", "Rate of incoming packets per second.", float64(stats.PPSIn), labels...)
+	b.gauge(prefix+"_packets_out_per_second", "Rate of outgoing packets per second.", float64(stats.PPSOut), labels...)
+	b.gauge(prefix+"_bytes_in_per_second", "Rate of incoming bytes per second.", float64(stats.BPSIn), labels...)
+	b.gauge(prefix+"_bytes_out_per_second", "Rate of outgoing bytes per second.", float64(stats.BPSOut), labels...)
+}
+
+// buildMetrics loads the current IPVS stats and builds the metrics of
+// services, destinations, health checks and VRRP.
+func (l *LoadBalancer) buildMetrics() (*metricsBuilder, error) {
+	b := newMetricsBuilder()
+	checkStats := l.checkers.stats()
+
+	l.mu.Lock()
+	err := l.loadIPVS()
+	if err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	for _, serviceAndDests := range l.servicesAndDests.services {
+		s := serviceAndDests.service
+		svcKey := ipvsServiceKey(s)
+		svcLabel := metricLabel{name: "service", value: svcKey}
+		b.addIPVSStats("goloba_service", s.Stats, svcLabel)
+
+		serviceConf := l.config.findService(svcKey)
+		for _, dest := range serviceAndDests.destinations {
+			d := dest.destination
+			labels := []metricLabel{
+				svcLabel,
+				{name: "destination", value: net.JoinHostPort(d.Address.String(), strconv.Itoa(int(d.Port)))},
+			}
+			b.addIPVSStats("goloba_destination", d.Stats, labels...)
+			b.gauge("goloba_destination_active_connections", "Number of active connections.", float64(d.ActiveConns), labels...)
+			b.gauge("goloba_destination_inactive_connections", "Number of inactive connections.", float64(d.InactConns), labels...)
+			b.gauge("goloba_destination_weight", "Current weight in IPVS.", float64(d.Weight), labels...)
+
+			if serviceConf == nil {
+				continue
+			}
+			destConf := serviceConf.findDestination(d.Address, d.Port)
+			if destConf == nil {
+				continue
+			}
+			b.gauge("goloba_destination_config_weight", "Weight in the config.", float64(destConf.Weight), labels...)
+			b.gauge("goloba_destination_detached", "Whether the destination is detached by health checks.", boolMetricValue(destConf.Detached), labels...)
+			b.gauge("goloba_destination_locked", "Whether the weight of the destination is locked.", boolMetricValue(destConf.Locked), labels...)
+			b.gauge("goloba_destination_draining", "Whether the destination is draining.", boolMetricValue(destConf.draining), labels...)
+
+			st, ok := checkStats[destinationKey(svcKey, d.Address, d.Port)]
+			if !ok {
+				continue
+			}
+			for _, r := range []struct {
+				result string
+				count  uint64
+			}{
+				{"success", st.Success},
+				{"failure", st.Failure},
+				{"error", st.Error},
+			} {
+				b.counter("goloba_healthcheck_results_total", "Total number of health check results.", float64(r.count),
+					append(labels, metricLabel{name: "result", value: r.result})...)
+			}
+			b.gauge("goloba_healthcheck_last_duration_seconds", "Duration of the last health check.", st.LastDuration.Seconds(), labels...)
+			b.summary("goloba_healthcheck_duration_seconds", "Durations of health checks.", st.DurationSum.Seconds(),
+				st.Success+st.Failure+st.Error, labels...)
+		}
+	}
+	l.mu.Unlock()
+
+	for _, n := range l.vrrpNodes {
+		status := n.status()
+		labels := []metricLabel{
+			{name: "vrid", value: strconv.Itoa(int(n.VRID))},
+			{name: "instance", value: n.Name},
+		}
+		for _, state := range []haState{haBackup, haMaster, haShutdown, haError} {
+			b.gauge("goloba_vrrp_state", "Current VRRP state.", boolMetricValue(status.State == state),
+				append(labels, metricLabel{name: "state", value: state.String()})...)
+		}
+		b.gauge("goloba_vrrp_state_since_seconds", "Unix time when the current VRRP state started.",
+			float64(status.Since.UnixNano())/float64(time.Second), labels...)
+		b.gauge("goloba_vrrp_maintenance", "Whether the VRRP instance is in maintenance mode.", boolMetricValue(status.Maintenance), labels...)
+		b.counter("goloba_vrrp_transitions_total", "Total number of VRRP state transitions.", float64(status.Transitions), labels...)
+		b.counter("goloba_vrrp_advertisements_sent_total", "Total number of sent VRRP advertisements.", float64(status.Sent), labels...)
+		b.counter("goloba_vrrp_advertisements_received_total", "Total number of received VRRP advertisements.", float64(status.Received), labels...)
+		b.counter("goloba_vrrp_advertisements_rejected_total", "Total number of VRRP advertisements rejected by the authentication.", float64(status.Rejected), labels...)
+	}
+	return b, nil
+}
@@ -0,0 +1,166 @@
+package goloba
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/netutil"
+	"github.com/mqliang/libipvs"
+)
+
+func newMetricsTestLoadBalancer() *LoadBalancer {
+	service := &libipvs.Service{
+		Protocol:      syscall.IPPROTO_TCP,
+		AddressFamily: syscall.AF_INET,
+		Address:       net.ParseIP("192.0.2.1").To4(),
+		Port:          80,
+		Stats:         libipvs.Stats{Connections: 3},
+	}
+	dest1 := &libipvs.Destination{
+		Address:     net.ParseIP("192.0.2.11").To4(),
+		Port:        8080,
+		Weight:      100,
+		ActiveConns: 2,
+	}
+	dest2 := &libipvs.Destination{
+		Address: net.ParseIP("192.0.2.12").To4(),
+		Port:    8080,
+		Weight:  0,
+	}
+	config := &Config{
+		Services: []ServiceConfig{
+			{
+				Address: netutil.IP(net.ParseIP("192.0.2.1")),
+				Port:    80,
+				Destinations: []DestinationConfig{
+					{Address: netutil.IP(net.ParseIP("192.0.2.11")), Port: 8080, Weight: 100},
+					{Address: netutil.IP(net.ParseIP("192.0.2.12")), Port: 8080, Weight: 50, Detached: true},
+				},
+			},
+		},
+	}
+	config.updateDestinations()
+
+	checkers := newHealthcheckers()
+	for _, addr := range []string{"192.0.2.11", "192.0.2.12"} {
+		destKey := destinationKey("tcp/192.0.2.1:80", net.ParseIP(addr), 8080)
+		checkers.checkers[destKey] = &healthchecker{
+			stats: healthcheckStats{Success: 5, Failure: 1, LastDuration: 10 * time.Millisecond, DurationSum: 60 * time.Millisecond},
+		}
+	}
+
+	return &LoadBalancer{
+		ipvs: &fakeIPVS{
+			services:     []*libipvs.Service{service},
+			destinations: map[*libipvs.Service][]*libipvs.Destination{service: {dest1, dest2}},
+		},
+		checkers: checkers,
+		config:   config,
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	l := newMetricsTestLoadBalancer()
+	w := httptest.NewRecorder()
+	wrapWithErrHandler(l.handleMetrics).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got=%d, want=%d, body=%s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got, want := w.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("content type: got=%q, want=%q", got, want)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	helps := make(map[string]bool)
+	types := make(map[string]string)
+	series := make(map[string]int)
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			name := strings.Fields(line)[2]
+			if helps[name] {
+				t.Errorf("duplicate HELP line for %s", name)
+			}
+			helps[name] = true
+		case strings.HasPrefix(line, "# TYPE "):
+			f := strings.Fields(line)
+			if len(f) != 4 {
+				t.Errorf("bad TYPE line: %q", line)
+				continue
+			}
+			if !helps[f[2]] {
+				t.Errorf("TYPE line before HELP line for %s", f[2])
+			}
+			types[f[2]] = f[3]
+		default:
+			i := strings.LastIndexByte(line, ' ')
+			if i < 0 {
+				t.Errorf("bad sample line: %q", line)
+				continue
+			}
+			series[line[:i]]++
+		}
+	}
+	for s, n := range series {
+		if n > 1 {
+			t.Errorf("%d samples for series %s, want 1", n, s)
+		}
+	}
+
+	wantTypes := map[string]string{
+		"goloba_destination_weight":            "gauge",
+		"goloba_destination_connections_total": "counter",
+		"goloba_healthcheck_results_total":     "counter",
+		"goloba_healthcheck_duration_seconds":  "summary",
+	}
+	for name, typ := range wantTypes {
+		if types[name] != typ {
+			t.Errorf("type of %s: got=%q, want=%q", name, types[name], typ)
+		}
+	}
+
+	wantSeries := []string{
+		`goloba_service_connections_total{service="tcp/192.0.2.1:80"}`,
+		`goloba_destination_weight{service="tcp/192.0.2.1:80",destination="192.0.2.11:8080"}`,
+		`goloba_destination_weight{service="tcp/192.0.2.1:80",destination="192.0.2.12:8080"}`,
+		`goloba_destination_detached{service="tcp/192.0.2.1:80",destination="192.0.2.12:8080"}`,
+		`goloba_healthcheck_results_total{service="tcp/192.0.2.1:80",destination="192.0.2.11:8080",result="success"}`,
+		`goloba_healthcheck_results_total{service="tcp/192.0.2.1:80",destination="192.0.2.12:8080",result="failure"}`,
+		`goloba_healthcheck_duration_seconds_sum{service="tcp/192.0.2.1:80",destination="192.0.2.11:8080"}`,
+		`goloba_healthcheck_duration_seconds_count{service="tcp/192.0.2.1:80",destination="192.0.2.12:8080"}`,
+	}
+	for _, s := range wantSeries {
+		if series[s] != 1 {
+			t.Errorf("series not found: %s", s)
+		}
+	}
+	if !strings.Contains(w.Body.String(), "\ngoloba_destination_active_connections{service=\"tcp/192.0.2.1:80\",destination=\"192.0.2.11:8080\"} 2\n") {
+		t.Error("active connections of destination not found")
+	}
+}
+
+func TestHandleMetricsMethodNotAllowed(t *testing.T) {
+	l := newMetricsTestLoadBalancer()
+	w := httptest.NewRecorder()
+	wrapWithErrHandler(l.handleMetrics).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status: got=%d, want=%d", w.Code, http.StatusMethodNotAllowed)
+	}
+	if got := w.Header().Get("Allow"); got != http.MethodGet {
+		t.Errorf("Allow header: got=%q, want=%q", got, http.MethodGet)
+	}
+}
+
+func TestEscapeMetrics(t *testing.T) {
+	if got, want := escapeMetricLabelValue("a\"b\\c\nd"), `a\"b\\c\nd`; got != want {
+		t.Errorf("escapeMetricLabelValue: got=%q, want=%q", got, want)
+	}
+	if got, want := escapeMetricHelp("a\"b\\c\nd"), `a"b\\c\nd`; got != want {
+		t.Errorf("escapeMetricHelp: got=%q, want=%q", got, want)
+	}
+}
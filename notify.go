@@ -0,0 +1,296 @@
+package goloba
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/ltsvlog"
+	"github.com/mqliang/libipvs"
+)
+
+// defaultNotifyTimeout is the default timeout of a notification hook.
+const defaultNotifyTimeout = 10 * time.Second
+
+// NotifyConfig is the configuration about a notification hook, which is
+// called on VRRP state transitions and on attaching or detaching destinations
+// by health checks. At least one of Exec and Webhook must be set.
+type NotifyConfig struct {
+	// Exec is the command executed with /bin/sh -c. The event is passed with
+	// the GOLOBA_* environment variables.
+	Exec string `yaml:"exec"`
+	// Webhook is the URL to which the event is posted in JSON.
+	Webhook string        `yaml:"webhook"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Events is the types of the events to notify, vrrp_state and/or
+	// destination. The empty list means all the events.
+	Events []string `yaml:"events"`
+}
+
+const (
+	notifyEventVRRPState   = "vrrp_state"
+	notifyEventDestination = "destination"
+)
+
+// notifyEvent is an event passed to the notification hooks.
+type notifyEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+
+	// Fields for vrrp_state events.
+	VRID     uint8  `json:"vrid,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	State    string `json:"state,omitempty"`
+	OldState string `json:"old_state,omitempty"`
+
+	// Fields for destination events. Action is attach or detach.
+	Service     string `json:"service,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Action      string `json:"action,omitempty"`
+}
+
+func (e *notifyEvent) environ() []string {
+	env := []string{
+		"GOLOBA_EVENT=" + e.Type,
+		"GOLOBA_TIME=" + e.Time.Format(time.RFC3339Nano),
+		"GOLOBA_HOSTNAME=" + e.Hostname,
+	}
+	switch e.Type {
+	case notifyEventVRRPState:
+		env = append(env,
+			"GOLOBA_VRID="+strconv.Itoa(int(e.VRID)),
+			"GOLOBA_INSTANCE="+e.Instance,
+			"GOLOBA_STATE="+e.State,
+			"GOLOBA_OLD_STATE="+e.OldState)
+	case notifyEventDestination:
+		env = append(env,
+			"GOLOBA_SERVICE="+e.Service,
+			"GOLOBA_DESTINATION="+e.Destination,
+			"GOLOBA_ACTION="+e.Action)
+	}
+	return env
+}
+
+func (c *NotifyConfig) wants(eventType string) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, t := range c.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyQueueSize is the maximum number of events waiting for a hook.
+// Events for a hook are dropped while its queue is full.
+const notifyQueueSize = 64
+
+// notifier calls the notification hooks. Each hook has a bounded queue
+// drained by a single worker goroutine, so that the events are delivered
+// in order and a hung hook does not pile up goroutines.
+type notifier struct {
+	configs []NotifyConfig
+	hooks   []*notifyHook
+}
+
+type notifyHook struct {
+	config NotifyConfig
+	queue  chan *notifyEvent
+}
+
+// newNotifier starts the workers for the hooks.
+func newNotifier(configs []NotifyConfig) *notifier {
+	n := &notifier{configs: configs}
+	for _, c := range configs {
+		h := &notifyHook{config: c, queue: make(chan *notifyEvent, notifyQueueSize)}
+		go h.run()
+		n.hooks = append(n.hooks, h)
+	}
+	return n
+}
+
+func (h *notifyHook) run() {
+	for ev := range h.queue {
+		err := h.config.call(ev)
+		if err != nil {
+			ltsvlog.Logger.Err(ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to call notification hook, err=%v", err)
+			}).String("event", ev.Type).String("exec", h.config.Exec).String("webhook", h.config.Webhook))
+		}
+	}
+}
+
+// notify queues the event for the hooks. It never blocks the caller.
+func (n *notifier) notify(ev *notifyEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Hostname == "" {
+		ev.Hostname, _ = os.Hostname()
+	}
+	for _, h := range n.hooks {
+		if !h.config.wants(ev.Type) {
+			continue
+		}
+		select {
+		case h.queue <- ev:
+		default:
+			ltsvlog.Logger.Info().String("msg", "dropped notification event since the queue of the hook is full").
+				String("event", ev.Type).String("exec", h.config.Exec).String("webhook", h.config.Webhook).Log()
+		}
+	}
+}
+
+// close stops the workers after they call the hooks for the queued events.
+func (n *notifier) close() {
+	for _, h := range n.hooks {
+		close(h.queue)
+	}
+}
+
+func (c *NotifyConfig) call(ev *notifyEvent) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if c.Exec != "" {
+		out, err := runNotifyCommand(ctx, c.Exec, ev.environ())
+		if err != nil {
+			return ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to execute notification command, err=%v", err)
+			}).String("output", strings.TrimSpace(string(out))).Stack("")
+		}
+	}
+	if c.Webhook != "" {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to marshal notification event, err=%v", err)
+			}).Stack("")
+		}
+		req, err := http.NewRequest(http.MethodPost, c.Webhook, bytes.NewReader(body))
+		if err != nil {
+			return ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to create webhook request, err=%v", err)
+			}).Stack("")
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return ltsvlog.WrapErr(err, func(err error) error {
+				return fmt.Errorf("failed to send webhook request, err=%v", err)
+			}).Stack("")
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return ltsvlog.Err(fmt.Errorf("unexpected webhook response status %d", resp.StatusCode)).
+				Int("status", resp.StatusCode).Stack("")
+		}
+	}
+	return nil
+}
+
+// runNotifyCommand runs the command with /bin/sh -c and returns its output.
+// The command runs in its own process group, and the whole group is killed
+// when ctx is done, so that a background child holding the output does not
+// keep the hook running after the timeout.
+func runNotifyCommand(ctx context.Context, command string, env []string) ([]byte, error) {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	close(done)
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return out.Bytes(), err
+}
+
+// notify queues the event for the notification hooks.
+func (l *LoadBalancer) notify(ev *notifyEvent) {
+	l.notifierMu.Lock()
+	defer l.notifierMu.Unlock()
+	if l.notifier != nil {
+		l.notifier.notify(ev)
+	}
+}
+
+// setNotifyHooks restarts the workers of the notification hooks if they
+// are changed. Events already queued are delivered to the old hooks.
+func (l *LoadBalancer) setNotifyHooks(hooks []NotifyConfig) {
+	l.notifierMu.Lock()
+	defer l.notifierMu.Unlock()
+	if l.notifier != nil {
+		if reflect.DeepEqual(l.notifier.configs, hooks) {
+			return
+		}
+		l.notifier.close()
+	}
+	l.notifier = newNotifier(hooks)
+}
+
+// closeNotifier stops the workers of the notification hooks.
+func (l *LoadBalancer) closeNotifier() {
+	l.notifierMu.Lock()
+	defer l.notifierMu.Unlock()
+	if l.notifier != nil {
+		l.notifier.close()
+		l.notifier = nil
+	}
+}
+
+// notifyDestination notifies attaching or detaching the destination.
+// The caller must hold l.mu.
+func (l *LoadBalancer) notifyDestination(service *libipvs.Service, destination *libipvs.Destination, action string) {
+	l.notify(&notifyEvent{
+		Type:        notifyEventDestination,
+		Service:     ipvsServiceKey(service),
+		Destination: net.JoinHostPort(destination.Address.String(), strconv.Itoa(int(destination.Port))),
+		Action:      action,
+	})
+}
+
+// notifyVRRPState notifies a VRRP state transition of the node. It does not
+// wait for l.mu so that it does not block the VRRP loop.
+func (l *LoadBalancer) notifyVRRPState(node *haNode, oldState, state haState) {
+	l.notify(&notifyEvent{
+		Type:     notifyEventVRRPState,
+		VRID:     node.VRID,
+		Instance: node.Name,
+		State:    state.String(),
+		OldState: oldState.String(),
+	})
+}
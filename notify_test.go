@@ -0,0 +1,211 @@
+package goloba
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newNotifyTestLoadBalancer(hooks []NotifyConfig) (*LoadBalancer, *haNode) {
+	node := newHANode(haNodeConfig{
+		haConfig: haConfig{
+			LocalAddr:  net.ParseIP("192.0.2.2").To4(),
+			RemoteAddr: net.ParseIP("224.0.0.18").To4(),
+			Priority:   100,
+			VRID:       1,
+		},
+		Name:                 "group1",
+		MasterAdvertInterval: time.Second,
+	}, newFakeHAConn(), &haEngine{config: &haEngineConfig{}})
+	l := &LoadBalancer{
+		config:    &Config{Notify: hooks},
+		vrrpNodes: []*haNode{node},
+	}
+	l.setNotifyHooks(hooks)
+	node.onStateChange = func(oldState, state haState) {
+		l.notifyVRRPState(node, oldState, state)
+	}
+	return l, node
+}
+
+func TestNotifyWebhook(t *testing.T) {
+	type request struct {
+		method      string
+		contentType string
+		event       map[string]interface{}
+	}
+	reqC := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{method: r.Method, contentType: r.Header.Get("Content-Type")}
+		if err := json.NewDecoder(r.Body).Decode(&req.event); err != nil {
+			t.Errorf("failed to decode webhook payload, err=%v", err)
+		}
+		reqC <- req
+	}))
+	defer srv.Close()
+
+	l, node := newNotifyTestLoadBalancer([]NotifyConfig{{Webhook: srv.URL}})
+	defer l.closeNotifier()
+	node.setState(haMaster)
+
+	var req request
+	select {
+	case req = <-reqC:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	if req.method != http.MethodPost {
+		t.Errorf("method: got=%s, want=%s", req.method, http.MethodPost)
+	}
+	if req.contentType != "application/json" {
+		t.Errorf("content type: got=%s, want=application/json", req.contentType)
+	}
+	want := map[string]interface{}{
+		"type":      "vrrp_state",
+		"vrid":      float64(1),
+		"instance":  "group1",
+		"state":     "master",
+		"old_state": "backup",
+	}
+	for k, v := range want {
+		if req.event[k] != v {
+			t.Errorf("payload %s: got=%v, want=%v", k, req.event[k], v)
+		}
+	}
+	for _, k := range []string{"time", "hostname"} {
+		if s, _ := req.event[k].(string); s == "" {
+			t.Errorf("payload %s is not set", k)
+		}
+	}
+	for _, k := range []string{"service", "destination", "action"} {
+		if _, ok := req.event[k]; ok {
+			t.Errorf("payload has %s for vrrp_state event", k)
+		}
+	}
+}
+
+func TestNotifyWebhookDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	hooks := []NotifyConfig{
+		{Webhook: slow.URL, Timeout: 100 * time.Millisecond},
+		{Webhook: failing.URL},
+	}
+	for _, hook := range hooks {
+		if err := hook.call(&notifyEvent{Type: notifyEventVRRPState}); err == nil {
+			t.Errorf("call of webhook %s: got no error", hook.Webhook)
+		}
+	}
+
+	l, node := newNotifyTestLoadBalancer(hooks)
+	defer l.closeNotifier()
+	// The hooks must not wait for l.mu either.
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		node.setState(haMaster)
+		node.setState(haBackup)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("state change blocked by notification hooks")
+	}
+	if got := node.state(); got != haBackup {
+		t.Errorf("state: got=%v, want=%v", got, haBackup)
+	}
+}
+
+func TestNotifyOrder(t *testing.T) {
+	const n = 20
+	stateC := make(chan string, n)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev notifyEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode webhook payload, err=%v", err)
+		}
+		stateC <- ev.State
+	}))
+	defer srv.Close()
+
+	l, node := newNotifyTestLoadBalancer([]NotifyConfig{{Webhook: srv.URL}})
+	defer l.closeNotifier()
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			node.setState(haMaster)
+		} else {
+			node.setState(haBackup)
+		}
+	}
+	for i := 0; i < n; i++ {
+		want := "master"
+		if i%2 == 1 {
+			want = "backup"
+		}
+		select {
+		case got := <-stateC:
+			if got != want {
+				t.Fatalf("event %d: state got=%s, want=%s", i, got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %d not delivered", i)
+		}
+	}
+}
+
+func TestNotifyQueueBounded(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	n := newNotifier([]NotifyConfig{{Webhook: srv.URL, Timeout: time.Minute}})
+	defer n.close()
+	for i := 0; i < 3*notifyQueueSize; i++ {
+		n.notify(&notifyEvent{Type: notifyEventDestination})
+	}
+	if got := len(n.hooks[0].queue); got > notifyQueueSize {
+		t.Errorf("queue length: got=%d, want<=%d", got, notifyQueueSize)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("concurrent calls of hung hook: got=%d, want=1", got)
+	}
+}
+
+func TestNotifyExecTimeout(t *testing.T) {
+	hook := NotifyConfig{
+		// The background sleep holds the output of the shell.
+		Exec:    "sleep 10 & wait",
+		Timeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	if err := hook.call(&notifyEvent{Type: notifyEventDestination}); err == nil {
+		t.Error("call: got no error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("call: returned after %s, want about %s", elapsed, hook.Timeout)
+	}
+}
@@ -0,0 +1,137 @@
+package goloba
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+type reloadRequest struct {
+	config  *Config
+	resultC chan reloadResult
+}
+
+type reloadResult struct {
+	ignored []string
+	err     error
+}
+
+// ReloadConfig loads the configuration again from the file which the current
+// configuration was loaded from, and applies the difference to IPVS and
+// health checkers without restarting the load balancer.
+//
+// Runtime states of destinations which still exist in the new configuration,
+// such as Detached, Locked, draining and removed, are kept.
+// Changes of pid_file, error_log, enable_debug_log, api and vrrp are ignored
+// since they need a restart, and the names of the changed ones are returned.
+func (l *LoadBalancer) ReloadConfig(ctx context.Context) (ignored []string, err error) {
+	l.mu.RLock()
+	file := l.config.file
+	l.mu.RUnlock()
+	if file == "" {
+		return nil, ltsvlog.Err(errors.New("cannot reload config which was not loaded from a file")).Stack("")
+	}
+
+	config, err := LoadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reloading is done in the health check loop so that it does not
+	// interleave with handling health check results.
+	req := &reloadRequest{config: config, resultC: make(chan reloadResult, 1)}
+	select {
+	case l.reloadC <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case result := <-req.resultC:
+		return result.ignored, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (l *LoadBalancer) reloadConfig(ctx context.Context, config *Config) ([]string, error) {
+	l.mu.RLock()
+	oldConfig := l.config
+	l.mu.RUnlock()
+
+	ignored := config.keepNonReloadable(oldConfig)
+	err := l.applyConfig(ctx, config)
+	if err != nil {
+		return nil, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to reload config, err=%v", err)
+		}).String("configFile", config.file)
+	}
+	ltsvlog.Logger.Info().String("msg", "reloaded config").String("configFile", config.file).Log()
+	return ignored, nil
+}
+
+// keepNonReloadable copies the settings which cannot be changed without
+// restarting the worker from old. It returns the names of the settings
+// whose changes are ignored.
+func (c *Config) keepNonReloadable(old *Config) []string {
+	var ignored []string
+	if c.PIDFile != old.PIDFile {
+		ignored = append(ignored, "pid_file")
+	}
+	if c.ErrorLog != old.ErrorLog {
+		ignored = append(ignored, "error_log")
+	}
+	if c.EnableDebugLog != old.EnableDebugLog {
+		ignored = append(ignored, "enable_debug_log")
+	}
+	if c.API != old.API {
+		ignored = append(ignored, "api")
+	}
+	if !reflect.DeepEqual(c.VRRP, old.VRRP) {
+		ignored = append(ignored, "vrrp")
+	}
+	if len(ignored) > 0 {
+		ltsvlog.Logger.Info().String("msg", "ignored changes in reloaded config; restart goloba to apply them").
+			String("configFile", c.file).String("ignored", strings.Join(ignored, ",")).Log()
+	}
+	c.PIDFile = old.PIDFile
+	c.ErrorLog = old.ErrorLog
+	c.EnableDebugLog = old.EnableDebugLog
+	c.API = old.API
+	c.VRRP = old.VRRP
+	return ignored
+}
+
+// inheritRuntimeState copies the runtime state of destinations which exist
+// in both c and old.
+func (c *Config) inheritRuntimeState(old *Config) {
+	for destKey, destConf := range c.destinations {
+		oldDestConf := old.findDestination(destKey)
+		if oldDestConf == nil {
+			continue
+		}
+		destConf.Detached = oldDestConf.Detached
+		destConf.successStreak = oldDestConf.successStreak
+		destConf.failureStreak = oldDestConf.failureStreak
+		destConf.slowStartCancel = oldDestConf.slowStartCancel
+		destConf.slowStartStep = oldDestConf.slowStartStep
+		if oldDestConf.Locked {
+			// The weight of a locked destination was set by the operator
+			// via the API, so we keep it too.
+			destConf.Locked = true
+			destConf.Weight = oldDestConf.Weight
+		}
+		// A draining destination stays at weight zero until the operator
+		// changes its weight, so that a drain in progress is not undone.
+		destConf.draining = oldDestConf.draining
+		destConf.removed = oldDestConf.removed
+	}
+	for destKey, oldDestConf := range old.destinations {
+		if c.findDestination(destKey) == nil {
+			oldDestConf.stopSlowStart()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package goloba
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/hnakamur/netutil"
+)
+
+func TestInheritRuntimeState(t *testing.T) {
+	newConfig := func(destAddrs ...string) *Config {
+		s := ServiceConfig{Address: netutil.IP(net.ParseIP("192.0.2.1")), Port: 80}
+		for _, addr := range destAddrs {
+			s.Destinations = append(s.Destinations, DestinationConfig{
+				Address: netutil.IP(net.ParseIP(addr)), Port: 8080, Weight: 100,
+			})
+		}
+		c := &Config{Services: []ServiceConfig{s}}
+		c.updateDestinations()
+		return c
+	}
+	keptKey := "tcp/192.0.2.1:80,192.0.2.11:8080"
+	removedKey := "tcp/192.0.2.1:80,192.0.2.12:8080"
+	addedKey := "tcp/192.0.2.1:80,192.0.2.13:8080"
+
+	old := newConfig("192.0.2.11", "192.0.2.12")
+	keptCanceled := false
+	kept := old.findDestination(keptKey)
+	kept.Detached = true
+	kept.successStreak = 2
+	kept.failureStreak = 1
+	kept.slowStartCancel = func() { keptCanceled = true }
+	kept.slowStartStep = 3
+	kept.Locked = true
+	kept.Weight = 7
+	kept.draining = true
+	removedCanceled := false
+	old.findDestination(removedKey).slowStartCancel = func() { removedCanceled = true }
+
+	c := newConfig("192.0.2.11", "192.0.2.13")
+	c.inheritRuntimeState(old)
+
+	got := c.findDestination(keptKey)
+	if !got.Detached || got.successStreak != 2 || got.failureStreak != 1 {
+		t.Errorf("health check state: got detached=%v rise=%d fall=%d, want true 2 1", got.Detached, got.successStreak, got.failureStreak)
+	}
+	if got.slowStartCancel == nil || got.slowStartStep != 3 {
+		t.Errorf("slow start: got cancel=%v step=%d, want set and 3", got.slowStartCancel != nil, got.slowStartStep)
+	}
+	if !got.Locked || got.Weight != 7 {
+		t.Errorf("lock: got locked=%v weight=%d, want true 7", got.Locked, got.Weight)
+	}
+	if !got.draining {
+		t.Error("draining: got=false, want=true")
+	}
+	if keptCanceled {
+		t.Error("slow start of kept destination canceled")
+	}
+	if !removedCanceled {
+		t.Error("slow start of removed destination not canceled")
+	}
+
+	added := c.findDestination(addedKey)
+	if added.Detached || added.Locked || added.draining || added.Weight != 100 {
+		t.Errorf("added destination: got %+v, want no runtime state", added)
+	}
+}
+
+func TestKeepNonReloadable(t *testing.T) {
+	old := &Config{
+		API:  APIConfig{ListenAddress: "127.0.0.1:8880"},
+		VRRP: VRRPConfig{Enabled: true, VRID: 1, Priority: 100},
+	}
+	c := &Config{
+		API:  APIConfig{ListenAddress: "127.0.0.1:8881"},
+		VRRP: VRRPConfig{Enabled: true, VRID: 1, Priority: 200},
+	}
+	ignored := c.keepNonReloadable(old)
+	if len(ignored) != 2 || ignored[0] != "api" || ignored[1] != "vrrp" {
+		t.Errorf("ignored: got=%v, want=[api vrrp]", ignored)
+	}
+	if c.API != old.API || c.VRRP.Priority != 100 {
+		t.Errorf("non-reloadable settings not kept: got api=%+v vrrp priority=%d", c.API, c.VRRP.Priority)
+	}
+	if ignored := c.keepNonReloadable(old); len(ignored) != 0 {
+		t.Errorf("ignored without changes: got=%v, want none", ignored)
+	}
+}
+
+func TestHandleConfigReloadIgnoredChanges(t *testing.T) {
+	dir, cleanup := writeTestConfigFiles(t, map[string]string{
+		"goloba.yml": "api:\n  listen_address: 127.0.0.1:8880\n",
+	})
+	defer cleanup()
+	file := filepath.Join(dir, "goloba.yml")
+	config, err := LoadConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &LoadBalancer{ipvs: &fakeIPVS{}, config: config, reloadC: make(chan *reloadRequest)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case req := <-l.reloadC:
+			ignored, err := l.reloadConfig(ctx, req.config)
+			req.resultC <- reloadResult{ignored: ignored, err: err}
+		case <-ctx.Done():
+		}
+	}()
+
+	err = ioutil.WriteFile(file, []byte("api:\n  listen_address: 127.0.0.1:8881\nvrrp:\n  priority: 200\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/config/reload", nil)
+	wrapWithErrHandler(l.handleConfigReload).ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: got=%d, want=%d, body=%s", w.Code, http.StatusOK, w.Body)
+	}
+	var resp struct {
+		Message        string   `json:"message"`
+		IgnoredChanges []string `json:"ignored_changes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.IgnoredChanges) != 2 || resp.IgnoredChanges[0] != "api" || resp.IgnoredChanges[1] != "vrrp" {
+		t.Errorf("ignored changes: got=%v, want=[api vrrp]", resp.IgnoredChanges)
+	}
+	if l.config.API.ListenAddress != "127.0.0.1:8880" {
+		t.Errorf("api after reload: got=%s, want=127.0.0.1:8880", l.config.API.ListenAddress)
+	}
+}
@@ -0,0 +1,165 @@
+package goloba
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hnakamur/ltsvlog"
+)
+
+// slowStartSteps is the number of steps to ramp up the weight of
+// a destination during the slow start period.
+const slowStartSteps = 10
+
+// minSlowStartStepInterval is the minimum interval between the steps of
+// the slow start.
+const minSlowStartStepInterval = 100 * time.Millisecond
+
+// minSlowStart is the minimum period of the slow start which is accepted
+// in the config.
+const minSlowStart = slowStartSteps * minSlowStartStepInterval
+
+// slowStartWeight returns the weight at the step of the slow start.
+func slowStartWeight(weight uint16, step int) uint16 {
+	if step >= slowStartSteps {
+		return weight
+	}
+	w := uint16(int(weight) * step / slowStartSteps)
+	if w == 0 && weight > 0 {
+		w = 1
+	}
+	return w
+}
+
+// slowStartProgress returns the progress of the slow start in percent,
+// or zero if the destination is not in the slow start.
+func (c *DestinationConfig) slowStartProgress() int {
+	if c.slowStartCancel == nil {
+		return 0
+	}
+	return c.slowStartStep * 100 / slowStartSteps
+}
+
+// startSlowStart starts ramping up the weight of the destination.
+// The caller must have set the IPVS weight to the weight of the first step,
+// and must hold l.mu.
+func (l *LoadBalancer) startSlowStart(ctx context.Context, destKey string, destConf *DestinationConfig) {
+	destConf.stopSlowStart()
+	ctx, cancel := context.WithCancel(ctx)
+	destConf.slowStartCancel = cancel
+	destConf.slowStartStep = 1
+	go l.runSlowStart(ctx, destKey, slowStartStepInterval(destConf.SlowStart))
+}
+
+// slowStartStepInterval returns the interval between the steps of the slow
+// start which takes the period.
+func slowStartStepInterval(period time.Duration) time.Duration {
+	interval := period / slowStartSteps
+	if interval < minSlowStartStepInterval {
+		interval = minSlowStartStepInterval
+	}
+	return interval
+}
+
+// stopSlowStart cancels the slow start of the destination if it is running.
+// The caller must hold l.mu of the load balancer.
+func (c *DestinationConfig) stopSlowStart() {
+	if c.slowStartCancel == nil {
+		return
+	}
+	c.slowStartCancel()
+	c.slowStartCancel = nil
+	c.slowStartStep = 0
+}
+
+func (l *LoadBalancer) runSlowStart(ctx context.Context, destKey string, stepInterval time.Duration) {
+	ticker := time.NewTicker(stepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			done, err := l.stepSlowStart(ctx, destKey)
+			if err != nil {
+				ltsvlog.Logger.Err(err)
+			}
+			if done {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (l *LoadBalancer) stepSlowStart(ctx context.Context, destKey string) (done bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The slow start may be canceled while we are waiting for the lock.
+	if ctx.Err() != nil {
+		return true, nil
+	}
+	destConf := l.config.findDestination(destKey)
+	if destConf == nil {
+		return true, nil
+	}
+
+	dest, err := l.loadIPVSDestination(destKey)
+	if err != nil {
+		return false, err
+	}
+	if dest == nil {
+		destConf.stopSlowStart()
+		return true, nil
+	}
+
+	destConf.slowStartStep++
+	weight := slowStartWeight(destConf.Weight, destConf.slowStartStep)
+	if destConf.slowStartStep >= slowStartSteps {
+		destConf.stopSlowStart()
+		done = true
+	}
+
+	service := dest.service
+	destination := dest.destination
+	destination.Weight = uint32(weight)
+	err = l.ipvs.UpdateDestination(service, destination)
+	if err != nil {
+		return done, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("faild to ramp up ipvs destination weight, err=%s", err)
+		}).String("destKey", destKey).Uint16("weight", weight).Stack("")
+	}
+	if done {
+		ltsvlog.Logger.Info().String("msg", "finished slow start of destination").
+			String("destKey", destKey).Uint16("weight", weight).Log()
+	} else if ltsvlog.Logger.DebugEnabled() {
+		ltsvlog.Logger.Debug().String("msg", "ramped up destination weight").
+			String("destKey", destKey).Uint16("weight", weight).Log()
+	}
+	return done, nil
+}
+
+// loadIPVSDestination reads the destination from IPVS. Only the destinations
+// of the service which the destination belongs to are listed, so that each
+// step of the slow start does not reload all services and destinations.
+// It returns nil if the destination does not exist.
+func (l *LoadBalancer) loadIPVSDestination(destKey string) (*ipvsDestination, error) {
+	cached := l.servicesAndDests.findDestination(destKey)
+	if cached == nil {
+		return nil, nil
+	}
+	service := cached.service
+	dests, err := l.ipvs.ListDestinations(service)
+	if err != nil {
+		return nil, ltsvlog.WrapErr(err, func(err error) error {
+			return fmt.Errorf("failed to list ipvs destinations, err=%v", err)
+		}).String("service", ipvsServiceKey(service)).Stack("")
+	}
+	for _, d := range dests {
+		if d.Address.Equal(cached.destination.Address) && d.Port == cached.destination.Port {
+			return &ipvsDestination{destination: d, service: service}, nil
+		}
+	}
+	return nil, nil
+}
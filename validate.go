@@ -0,0 +1,267 @@
+package goloba
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mqliang/libipvs"
+)
+
+// ConfigError is a problem in the config. File is the config file which has
+// the value, and Path is the YAML path of the value in the file, for example
+// services[0].destinations[1].port.
+type ConfigError struct {
+	File string
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.File != "" {
+		return e.File + ": " + e.Path + ": " + e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+// ValidationError is returned for an invalid config. Errors has all the
+// problems found by Config.Validate.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid config:\n" + strings.Join(msgs, "\n")
+}
+
+// ipvsSchedulers is the scheduling methods of IPVS.
+var ipvsSchedulers = map[string]bool{
+	"rr": true, "wrr": true, "lc": true, "wlc": true, "lblc": true, "lblcr": true,
+	"dh": true, "sh": true, "sed": true, "nq": true, "fo": true, "ovf": true, "mh": true,
+}
+
+// configErrors collects the problems found by Validate.
+type configErrors []error
+
+func (e *configErrors) add(path string, format string, args ...interface{}) {
+	*e = append(*e, &ConfigError{Path: path, Err: fmt.Errorf(format, args...)})
+}
+
+// addAt adds the error at loc. The same error is added only once since
+// the destinations which take a value from the same defaults block have
+// the same error.
+func (e *configErrors) addAt(loc configLocation, format string, args ...interface{}) {
+	err := &ConfigError{File: loc.file, Path: loc.path, Err: fmt.Errorf(format, args...)}
+	for _, x := range *e {
+		if ce, ok := x.(*ConfigError); ok && ce.File == err.File && ce.Path == err.Path && ce.Err.Error() == err.Err.Error() {
+			return
+		}
+	}
+	*e = append(*e, err)
+}
+
+// Validate checks the config and returns all the problems found, or nil if
+// the config is valid.
+func (c *Config) Validate() []error {
+	var errs configErrors
+	c.validateServices(&errs)
+	for i, n := range c.Notify {
+		if n.Exec == "" && n.Webhook == "" {
+			errs.add(fmt.Sprintf("notify[%d]", i), "exec or webhook must be set")
+		}
+		if n.Timeout < 0 {
+			errs.add(fmt.Sprintf("notify[%d].timeout", i), "must not be negative")
+		}
+	}
+	if c.VRRP.Enabled {
+		c.validateVRRP(&errs)
+	}
+	errs.setFile(0, c.file)
+	return errs
+}
+
+// setFile sets file to the errors from the index i which do not have a file.
+func (e configErrors) setFile(i int, file string) {
+	for _, err := range e[i:] {
+		if ce, ok := err.(*ConfigError); ok && ce.File == "" {
+			ce.File = file
+		}
+	}
+}
+
+// serviceLocation returns the location of the service at the index i.
+func (c *Config) serviceLocation(i int) configLocation {
+	s := &c.Services[i]
+	if s.source == "" {
+		return configLocation{file: c.file, path: fmt.Sprintf("services[%d]", i)}
+	}
+	return configLocation{file: s.source, path: fmt.Sprintf("services[%d]", s.sourceIndex)}
+}
+
+// relativeTo returns l for error messages about a value in file. The file
+// of l is omitted if it is file.
+func (l configLocation) relativeTo(file string) string {
+	if l.file == "" || l.file == file {
+		return l.path
+	}
+	return l.path + " in " + l.file
+}
+
+func (c *Config) validateServices(errs *configErrors) {
+	keys := make(map[string]configLocation)
+	names := make(map[string]configLocation)
+	for i := range c.Services {
+		s := &c.Services[i]
+		loc := c.serviceLocation(i)
+		n := len(*errs)
+		c.validateService(errs, s, loc, keys, names)
+		errs.setFile(n, loc.file)
+	}
+}
+
+// validateService validates the service at path. keys and names have the
+// locations of the services validated before to detect duplicates.
+func (c *Config) validateService(errs *configErrors, s *ServiceConfig, loc configLocation, keys, names map[string]configLocation) {
+	path := loc.path
+	if s.Name != "" {
+		if p, ok := names[s.Name]; ok {
+			errs.add(path+".name", "duplicate service name %q with %s", s.Name, p.relativeTo(loc.file))
+		}
+		names[s.Name] = loc
+	}
+	if _, err := parseProtocol(s.Protocol); err != nil {
+		errs.add(path+".protocol", "%v", err)
+	}
+	if _, err := parseAddressFamily(s.AddressFamily); err != nil {
+		errs.add(path+".address_family", "%v", err)
+	}
+	if s.FWMark == 0 && s.Address == nil {
+		errs.add(path+".address", "must be set unless fwmark is set")
+		return
+	}
+	svcKey := s.serviceKey()
+	if p, ok := keys[svcKey]; ok {
+		errs.add(path, "duplicate service %s with %s", svcKey, p.relativeTo(loc.file))
+	}
+	keys[svcKey] = loc
+	if !ipvsSchedulers[s.Schedule] {
+		errs.add(path+".schedule", "unknown schedule %q", s.Schedule)
+	}
+	switch s.Type {
+	case "", "dr", "nat":
+	default:
+		errs.add(path+".type", "unknown type %q, must be dr or nat", s.Type)
+	}
+
+	af := s.addressFamily()
+	if s.FWMark == 0 {
+		af = libipvs.AddressFamily(ipAddressFamily(net.IP(s.Address)))
+	}
+	destKeys := make(map[string]string)
+	for j := range s.Destinations {
+		d := &s.Destinations[j]
+		destPath := fmt.Sprintf("%s.destinations[%d]", path, j)
+		destIP := net.IP(d.Address)
+		if destIP == nil {
+			errs.add(destPath+".address", "must be set")
+			continue
+		}
+		destKey := destinationKey(svcKey, destIP, d.Port)
+		if p, ok := destKeys[destKey]; ok {
+			errs.add(destPath, "duplicate destination %s with %s", net.JoinHostPort(destIP.String(), fmt.Sprint(d.Port)), p)
+		}
+		destKeys[destKey] = destPath
+		if libipvs.AddressFamily(ipAddressFamily(destIP)) != af {
+			errs.add(destPath+".address", "address family of destination %s differs from service", destIP)
+		}
+		if d.SlowStart < 0 {
+			errs.add(destPath+".slow_start", "must not be negative")
+		} else if d.SlowStart > 0 && d.SlowStart < minSlowStart {
+			errs.add(destPath+".slow_start", "must be zero or at least %s", minSlowStart)
+		}
+		validateHealthCheck(errs, destPath+".health_check", &d.HealthCheck)
+		h := d.HealthCheck
+		if err := h.expandTemplates(newHealthCheckTemplateData(s, d)); err != nil {
+			errs.add(destPath+".health_check", "%v", err)
+		}
+	}
+}
+
+// validateHealthCheck validates the health check at path. An error in a
+// field taken from a defaults block is reported at the block.
+func validateHealthCheck(errs *configErrors, path string, h *HealthCheckConfig) {
+	if _, ok := lookupCheckerFactory(h.Type); !ok {
+		errs.addAt(h.fieldLocation(path, "type"), "unsupported health check type %q", h.Type)
+	}
+	if (h.Type == "" || h.Type == healthcheckTypeHTTP) && h.URL == "" {
+		errs.add(path+".url", "must be set for http health check")
+	}
+	if h.Interval <= 0 {
+		errs.addAt(h.fieldLocation(path, "interval"), "must be positive")
+	}
+	if h.Timeout < 0 {
+		errs.addAt(h.fieldLocation(path, "timeout"), "must not be negative")
+	}
+	if h.Rise < 0 {
+		errs.addAt(h.fieldLocation(path, "rise"), "must not be negative")
+	}
+	if h.Fall < 0 {
+		errs.addAt(h.fieldLocation(path, "fall"), "must not be negative")
+	}
+}
+
+func (c *Config) validateVRRP(errs *configErrors) {
+	if c.VRRP.TrackInterval < 0 {
+		errs.add("vrrp.track_interval", "must not be negative")
+	}
+	vrids := make(map[uint8]string)
+	for i, inst := range c.VRRP.instances() {
+		path := "vrrp"
+		if len(c.VRRP.Instances) > 0 {
+			path = fmt.Sprintf("vrrp.instances[%d]", i)
+		}
+		if inst.VRID == 0 {
+			errs.add(path+".vrid", "must be 1 to 255")
+		} else if p, ok := vrids[inst.VRID]; ok {
+			errs.add(path+".vrid", "duplicate vrid %d with %s", inst.VRID, p)
+		}
+		vrids[inst.VRID] = path
+		if inst.Priority == 0 || inst.Priority == 255 {
+			errs.add(path+".priority", "must be 1 to 254")
+		}
+		if net.ParseIP(inst.LocalAddress) == nil {
+			errs.add(path+".local_address", "invalid IP address %q", inst.LocalAddress)
+		}
+		if len(inst.UnicastPeers) == 0 && net.ParseIP(inst.RemoteAddress) == nil {
+			errs.add(path+".remote_address", "invalid IP address %q", inst.RemoteAddress)
+		}
+		for j, peer := range inst.UnicastPeers {
+			if net.ParseIP(peer) == nil {
+				errs.add(fmt.Sprintf("%s.unicast_peers[%d]", path, j), "invalid IP address %q", peer)
+			}
+		}
+		if inst.MasterAdvertInterval <= 0 {
+			errs.add(path+".master_advert_interval", "must be positive")
+		}
+		if inst.SendGARPInterval <= 0 {
+			errs.add(path+".send_garp_interval", "must be positive")
+		}
+		if inst.VIPInterface == "" {
+			errs.add(path+".vip_interface", "must be set")
+		}
+		for j, vip := range inst.VIPs {
+			if _, err := parseVIP(vip); err != nil {
+				errs.add(fmt.Sprintf("%s.vips[%d]", path, j), "%v", err)
+			}
+		}
+		for j, t := range inst.Track {
+			if err := c.validateVRRPTrack(&t); err != nil {
+				errs.add(fmt.Sprintf("%s.track[%d]", path, j), "%v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package goloba
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func validateTestConfig(t *testing.T, config string) []string {
+	var c Config
+	if err := yaml.UnmarshalStrict([]byte(config), &c); err != nil {
+		t.Fatalf("failed to parse config, err=%v", err)
+	}
+	c.file = "/etc/goloba.yml"
+	c.applyDefaults()
+	var msgs []string
+	for _, err := range c.Validate() {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func checkConfigErrors(t *testing.T, name string, got, want []string) {
+	if len(got) != len(want) {
+		t.Errorf("%s: errors unmatch, got=%q, want=%q", name, got, want)
+		return
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: errors[%d] unmatch, got=%q, want=%q", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "valid",
+			config: `
+services:
+- address: 192.0.2.1
+  port: 80
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+    health_check:
+      url: http://192.0.2.11/
+`,
+		},
+		{
+			name: "multiple",
+			config: `
+services:
+- address: 192.0.2.1
+  port: 80
+  schedule: foo
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+    health_check:
+      url: http://192.0.2.11/
+  - address: 192.0.2.12
+    port: 80
+    health_check:
+      url: http://192.0.2.12/
+      interval: -1s
+      timeout: -1s
+- address: 192.0.2.1
+  port: 80
+  protocol: icmp
+  destinations:
+  - address: 2001:db8::1
+    port: 80
+`,
+			want: []string{
+				`/etc/goloba.yml: services[0].schedule: unknown schedule "foo"`,
+				`/etc/goloba.yml: services[0].destinations[1].health_check.interval: must be positive`,
+				`/etc/goloba.yml: services[0].destinations[1].health_check.timeout: must not be negative`,
+				`/etc/goloba.yml: services[1].protocol: unsupported protocol "icmp", must be tcp, udp or sctp`,
+				`/etc/goloba.yml: services[1].destinations[0].address: address family of destination 2001:db8::1 differs from service`,
+				`/etc/goloba.yml: services[1].destinations[0].health_check.url: must be set for http health check`,
+			},
+		},
+		{
+			name: "negativeRiseFall",
+			config: `
+services:
+- address: 192.0.2.1
+  port: 80
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+    health_check:
+      url: http://192.0.2.11/
+      rise: -1
+      fall: -2
+`,
+			want: []string{
+				`/etc/goloba.yml: services[0].destinations[0].health_check.rise: must not be negative`,
+				`/etc/goloba.yml: services[0].destinations[0].health_check.fall: must not be negative`,
+			},
+		},
+		{
+			name: "defaults",
+			config: `
+defaults:
+  health_check:
+    url: http://192.0.2.1/
+    interval: -1s
+services:
+- address: 192.0.2.1
+  port: 80
+  health_check_defaults:
+    fall: -1
+  destinations:
+  - address: 192.0.2.11
+    port: 80
+  - address: 192.0.2.12
+    port: 80
+  - address: 192.0.2.13
+    port: 80
+    health_check:
+      interval: 1s
+      fall: -3
+`,
+			want: []string{
+				`/etc/goloba.yml: defaults.health_check.interval: must be positive`,
+				`/etc/goloba.yml: services[0].health_check_defaults.fall: must not be negative`,
+				`/etc/goloba.yml: services[0].destinations[2].health_check.fall: must not be negative`,
+			},
+		},
+	}
+	for _, tc := range testCases {
+		checkConfigErrors(t, tc.name, validateTestConfig(t, tc.config), tc.want)
+	}
+}